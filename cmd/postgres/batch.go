@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+const transactionExecModeKey = "transaction_exec_mode"
+
+// TransactionExecMode defines how queries of a single DriverTransaction reach the server.
+type TransactionExecMode int
+
+const (
+	// TransactionExecModeSequential sends every query and waits for its result before sending the next one.
+	TransactionExecModeSequential TransactionExecMode = iota
+	// TransactionExecModeBatch pipelines all queries of a transaction as a single pgx.Batch.
+	TransactionExecModeBatch
+)
+
+// parseTransactionExecMode rejects the batch mode with prepared statements or result reading,
+// which batches do not support.
+func parseTransactionExecMode(cfgMap map[string]any, prepared, readResults bool) (TransactionExecMode, error) {
+	rawAny, exists := cfgMap[transactionExecModeKey]
+	if !exists {
+		return TransactionExecModeSequential, nil
+	}
+
+	optMap := map[string]TransactionExecMode{
+		"sequential": TransactionExecModeSequential,
+		"batch":      TransactionExecModeBatch,
+	}
+
+	rawStr, _ := config.String(rawAny)
+	mode, ok := optMap[rawStr]
+	if !ok {
+		return 0, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+			rawAny, transactionExecModeKey,
+			slices.Collect(maps.Keys(optMap)),
+			pool.ErrUnsupportedParam,
+		)
+	}
+
+	if mode == TransactionExecModeBatch && (prepared || readResults) {
+		return 0, fmt.Errorf(`"%s" and "%s" are not supported with "%s" of "%s": %w`,
+			preparedStatementsKey, readResultsKey, rawStr, transactionExecModeKey, pool.ErrUnsupportedParam)
+	}
+
+	return mode, nil
+}
+
+// batchConn is a connection a batch and the statements finishing its transaction run on.
+type batchConn interface {
+	Executor
+	BatchExecutor
+}
+
+// runTransactionBatchOn runs the batch on the pool, a connection is pinned for explicit transactions,
+// since COMMIT or ROLLBACK following the batch must reach the same connection.
+func (d *Driver) runTransactionBatchOn(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	mode TxMode,
+	connPool ConnPool,
+) error {
+	if !d.batchTransaction(transaction, mode) {
+		return d.runTransactionBatch(ctx, transaction, connPool)
+	}
+
+	conn, err := connPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return d.runTransactionBatch(ctx, transaction, conn.Conn())
+}
+
+// batchTransaction reports whether the batch is wrapped with BEGIN,
+// rows validation needs it too, since an implicit transaction is committed before results are checked.
+func (d *Driver) batchTransaction(transaction *stroppy.DriverTransaction, mode TxMode) bool {
+	return d.explicitTransaction(transaction, mode) || d.validator.Fails(transaction)
+}
+
+// runTransactionBatch sends all queries of the transaction in one round trip.
+// Only the transaction latency is recorded, queries of a pipeline have no latencies of their own.
+// When isolation level, transaction mode, local settings or rows validation are set the batch is wrapped
+// with BEGIN/COMMIT, otherwise the server runs the pipeline in a single implicit transaction.
+// With rows validation COMMIT is sent after the results are checked, so a mismatch rolls the transaction back.
+// A failed explicit transaction is rolled back, so the connection is reused rather than destroyed by the pool.
+func (d *Driver) runTransactionBatch(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	conn batchConn,
+) error {
+	batch := &pgx.Batch{}
+	// owners are DriverQuery of every queued statement, nil for BEGIN, COMMIT and SET LOCAL.
+	owners := make([]*stroppy.DriverQuery, 0, len(transaction.GetQueries())+2) //nolint: mnd // BEGIN and COMMIT
+
+	queue := func(owner *stroppy.DriverQuery, sql string, args ...any) {
+		batch.Queue(sql, args...)
+		owners = append(owners, owner)
+	}
+
+	queueLocal := func(settings []localSetting) {
+		if len(settings) > 0 {
+			sql, args := setLocalSQL(settings)
+			queue(nil, sql, args...)
+		}
+	}
+
+	mode := d.txModes.For(transaction)
+	validated := d.validator.Fails(transaction)
+
+	explicitTx := d.batchTransaction(transaction, mode)
+	if explicitTx {
+		txSettings, err := NewStroppyIsolationSettings(transaction, mode)
+		if err != nil {
+			return err
+		}
+
+		queue(nil, beginSQL(txSettings.TxOpts()))
+	}
+
+	queueLocal(d.local.forTransaction(transaction))
+
+	for _, query := range transaction.GetQueries() {
+		values, err := d.queryValues(query)
+		if err != nil {
+			return err
+		}
+
+		queueLocal(d.local.forQuery(transaction, query))
+		d.registerWaitQuery(query.GetRequest(), query.GetName())
+		queue(query, query.GetRequest(), values...)
+	}
+
+	if explicitTx && !validated {
+		queue(nil, "COMMIT")
+	}
+
+	ctx = pool.WithQueryName(ctx, transactionLabel(transaction))
+
+	err := d.readBatch(conn.SendBatch(ctx, batch), owners)
+	if err != nil {
+		if explicitTx {
+			// NOTE: ROLLBACK after a committed or already rolled back transaction only warns.
+			_, _ = conn.Exec(ctx, "ROLLBACK")
+		}
+
+		return err
+	}
+
+	if explicitTx && validated {
+		_, err = conn.Exec(ctx, "COMMIT")
+	}
+
+	return err
+}
+
+// readBatch reads results of every queued statement and checks rows of the queries.
+func (d *Driver) readBatch(results pgx.BatchResults, owners []*stroppy.DriverQuery) error {
+	for _, query := range owners {
+		tag, err := results.Exec()
+		if err == nil && query != nil {
+			err = d.validator.Check(query, tag.RowsAffected())
+		}
+
+		if err != nil {
+			_ = results.Close()
+
+			if query != nil {
+				return queryError(query, err)
+			}
+
+			return err
+		}
+	}
+
+	return results.Close()
+}
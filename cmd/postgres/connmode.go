@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/queries"
+)
+
+const connectionModeKey = "connection_mode"
+
+// connCloseTimeout bounds sending Terminate, the connection is closed even if the run is canceled.
+const connCloseTimeout = 5 * time.Second
+
+// ConnectionMode defines where transactions get their connection from.
+type ConnectionMode int
+
+const (
+	// ConnectionModePool reuses pooled connections.
+	ConnectionModePool ConnectionMode = iota
+	// ConnectionModePerTransaction opens a new connection for every transaction and closes it afterwards,
+	// like pgbench -C, so connection establishment is part of the measured work.
+	ConnectionModePerTransaction
+)
+
+const (
+	connectionPhaseConnect = "connect"
+	connectionPhaseClose   = "close"
+)
+
+// Connector opens connections outside of the pool, e.g. *pool.Pool.
+type Connector interface {
+	Connect(ctx context.Context) (*pgx.Conn, error)
+}
+
+func parseConnectionMode(cfgMap map[string]any) (ConnectionMode, error) {
+	rawAny, exists := cfgMap[connectionModeKey]
+	if !exists {
+		return ConnectionModePool, nil
+	}
+
+	optMap := map[string]ConnectionMode{
+		"pool":            ConnectionModePool,
+		"per_transaction": ConnectionModePerTransaction,
+	}
+
+	rawStr, _ := config.String(rawAny)
+	if mode, ok := optMap[rawStr]; ok {
+		return mode, nil
+	}
+
+	return 0, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+		rawAny, connectionModeKey,
+		slices.Collect(maps.Keys(optMap)),
+		pool.ErrUnsupportedParam,
+	)
+}
+
+// runTransactionOnNewConn runs the transaction on a connection opened for it alone,
+// connect and close durations are recorded as connection latencies.
+func (d *Driver) runTransactionOnNewConn(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	mode TxMode,
+	connector Connector,
+) error {
+	start := time.Now()
+	conn, err := connector.Connect(ctx)
+	d.latencies.RecordConnection(connectionPhaseConnect, time.Since(start))
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), connCloseTimeout)
+		defer cancel()
+
+		start := time.Now()
+		_ = conn.Close(closeCtx)
+		d.latencies.RecordConnection(connectionPhaseClose, time.Since(start))
+	}()
+
+	return d.runTransactionOnConn(ctx, transaction, mode, conn)
+}
+
+// runTransactionOnConn is runTransactionOn for a single connection, so nothing has to be acquired.
+func (d *Driver) runTransactionOnConn(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	mode TxMode,
+	conn *pgx.Conn,
+) error {
+	if queries.IsCopyTransaction(transaction) {
+		return d.runTransactionCopy(ctx, transaction, conn)
+	}
+
+	if d.execMode == TransactionExecModeBatch {
+		return d.runTransactionBatch(ctx, transaction, conn)
+	}
+
+	if !d.explicitTransaction(transaction, mode) {
+		return d.runTransactionInternal(ctx, transaction, conn)
+	}
+
+	txSettings, err := NewStroppyIsolationSettings(transaction, mode)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginTxFunc(ctx, conn, txSettings.TxOpts(), func(tx pgx.Tx) error {
+		return d.runTransactionInternal(ctx, transaction, tx)
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseConnectionMode(t *testing.T) {
+	mode, err := parseConnectionMode(map[string]any{})
+	require.NoError(t, err)
+	require.Equal(t, ConnectionModePool, mode)
+
+	mode, err = parseConnectionMode(map[string]any{connectionModeKey: "per_transaction"})
+	require.NoError(t, err)
+	require.Equal(t, ConnectionModePerTransaction, mode)
+
+	_, err = parseConnectionMode(map[string]any{connectionModeKey: "per_query"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
+
+// fakeServer accepts connections and answers every simple query with CommandComplete,
+// it returns the URL and counters of accepted connections and received queries.
+func fakeServer(t *testing.T) (string, *atomic.Int64, *atomic.Int64) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var conns, queries atomic.Int64
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		backend := pgproto3.NewBackend(conn, conn)
+
+		if _, err := backend.ReceiveStartupMessage(); err != nil {
+			return
+		}
+
+		backend.Send(&pgproto3.AuthenticationOk{})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+		if backend.Flush() != nil {
+			return
+		}
+
+		for {
+			msg, err := backend.Receive()
+			if err != nil {
+				return
+			}
+
+			switch msg.(type) {
+			case *pgproto3.Query:
+				queries.Add(1)
+				backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("UPDATE 1")})
+				backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+				if backend.Flush() != nil {
+					return
+				}
+			case *pgproto3.Terminate:
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			conns.Add(1)
+
+			go serve(conn)
+		}
+	}()
+
+	return "postgres://stroppy@" + listener.Addr().String() + "/bench?sslmode=disable&default_query_exec_mode=simple_protocol",
+		&conns, &queries
+}
+
+type urlConnector string
+
+func (c urlConnector) Connect(ctx context.Context) (*pgx.Conn, error) {
+	return pgx.Connect(ctx, string(c))
+}
+
+type failingConnector struct{}
+
+func (failingConnector) Connect(context.Context) (*pgx.Conn, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestDriver_RunTransaction_PerTransactionConnection(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	url, conns, queries := fakeServer(t)
+
+	drv := newTestDriver(mock)
+	drv.connMode = ConnectionModePerTransaction
+	drv.connector = urlConnector(url)
+
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "payment", Request: "UPDATE accounts SET balance = 0"},
+			{Name: "history", Request: "UPDATE history SET amount = 0"},
+		},
+	}
+
+	for range 3 {
+		require.NoError(t, drv.RunTransaction(context.Background(), transaction))
+	}
+
+	require.Equal(t, int64(3), conns.Load(), "every transaction opens its own connection")
+	require.Equal(t, int64(6), queries.Load())
+	require.NoError(t, mock.ExpectationsWereMet(), "the pool is not used")
+
+	report := drv.latencies.Report()
+	require.Equal(t, uint64(3), report.Connections[connectionPhaseConnect].Count)
+	require.Equal(t, uint64(3), report.Connections[connectionPhaseClose].Count)
+
+	drv.connector = failingConnector{}
+	require.ErrorContains(t, drv.RunTransaction(context.Background(), transaction), "connection refused")
+	require.Equal(t, uint64(4), drv.latencies.Report().Connections[connectionPhaseConnect].Count)
+}
+
+func TestDriver_RunTransaction_PerTransactionConnectionWithoutConnector(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.connMode = ConnectionModePerTransaction
+
+	mock.ExpectExec("SELECT 1").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	require.NoError(t, drv.RunTransaction(context.Background(), &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "q", Request: "SELECT 1"}},
+	}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
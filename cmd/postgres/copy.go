@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/queries"
+)
+
+// runTransactionCopy streams rows of the COPY chunk built by the query builder in "copy" insert mode,
+// each DriverQuery params are converted to a row only when pgx asks for it.
+func (d *Driver) runTransactionCopy(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	executor CopyFromExecutor,
+) error {
+	rows := transaction.GetQueries()
+
+	tableName, columns, ok := queries.ParseCopyRequest(rows[0].GetRequest())
+	if !ok {
+		return queries.ErrNotInsertOnly
+	}
+
+	idx := 0
+	ctx = pool.WithQueryName(ctx, rows[0].GetName())
+
+	d.registerWaitQuery(copyFromSQL(tableName, columns), rows[0].GetName())
+
+	_, err := executor.CopyFrom(ctx, tableName, columns, pgx.CopyFromFunc(func() ([]any, error) {
+		if idx == len(rows) {
+			return nil, nil
+		}
+
+		values, err := d.queryValues(rows[idx])
+		idx++
+
+		return values, err
+	}))
+
+	return queryError(rows[0], err)
+}
+
+// copyFromSQL is the statement pgx.CopyFrom sends, so pg_stat_activity of COPY matches the registered query.
+func copyFromSQL(tableName pgx.Identifier, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pgx.Identifier{column}.Sanitize()
+	}
+
+	return fmt.Sprintf("copy %s ( %s ) from stdin binary;", tableName.Sanitize(), strings.Join(quoted, ", "))
+}
@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
+	"time"
 
-	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
 	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 
 	"github.com/stroppy-io/stroppy-core/pkg/logger"
 	"github.com/stroppy-io/stroppy-core/pkg/plugins/driver"
 	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+	"github.com/stroppy-io/stroppy-core/pkg/protovalue"
 	"github.com/stroppy-io/stroppy-core/pkg/utils/errchan"
 
+	"github.com/stroppy-io/stroppy-postgres/internal/pgstat"
 	"github.com/stroppy-io/stroppy-postgres/internal/pool"
 	"github.com/stroppy-io/stroppy-postgres/internal/queries"
 )
 
+// releaseTimeout bounds cleanup after a failed Initialize, e.g. removal of the heartbeat row.
+const releaseTimeout = 5 * time.Second
+
 type QueryBuilder interface {
 	Build(
 		ctx context.Context,
@@ -31,15 +39,43 @@ type QueryBuilder interface {
 	ValueToPgxValue(value *stroppy.Value) (any, error)
 }
 
+// ConnPool is the pool transactions run on, the primary or a replica.
+type ConnPool interface {
+	Executor
+	BatchExecutor
+	CopyFromExecutor
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+	Stat() *pgxpool.Stat
+	Close()
+}
+
 type Driver struct {
-	logger  *zap.Logger
-	pgxPool interface {
-		Executor
-		Close()
-	}
-	txManager  *manager.Manager
-	txExecutor *TxExecutor
-	builder    QueryBuilder
+	logger      *zap.Logger
+	pgxPool     ConnPool
+	txManager   *manager.Manager
+	txExecutor  *TxExecutor
+	builder     QueryBuilder
+	retryPolicy *RetryPolicy
+	execMode    TransactionExecMode
+	connMode    ConnectionMode
+	connector   Connector
+	prepared    bool
+	readResults bool
+	validator   *ResultValidator
+	latencies   *LatencyRecorder
+	errAccount  *ErrorAccounting
+	metrics     *MetricsServer
+	serverStats *ServerStats
+	waitEvents  *waitEventsConfig
+	waitSampler *pgstat.WaitSampler
+	local       LocalSettings
+	txModes     TxModes
+	failover    *pool.FailoverMonitor
+	tlsStats    *pool.TLSStats
+	replicas    *ReplicaRouter
+
+	replicationLag *replicationLagConfig
+	lagMonitor     *pgstat.LagMonitor
 }
 
 func NewDriver() driver.Plugin { //nolint: ireturn // allow
@@ -51,9 +87,101 @@ func NewDriver() driver.Plugin { //nolint: ireturn // allow
 }
 
 func (d *Driver) Initialize(ctx context.Context, runContext *stroppy.StepContext) error {
+	driverConfig := runContext.GetGlobalConfig().GetRun().GetDriver()
+
+	cfgMap, err := protovalue.ValueStructToMap(driverConfig.GetDbSpecific())
+	if err != nil {
+		return err
+	}
+
+	err = dbSpecificSchema.Validate(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.retryPolicy, err = parseRetryPolicy(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.connMode, err = parseConnectionMode(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.prepared, err = parsePreparedStatements(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.readResults, err = parseReadResults(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.execMode, err = parseTransactionExecMode(cfgMap, d.prepared, d.readResults)
+	if err != nil {
+		return err
+	}
+
+	d.validator, err = parseResultValidator(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.latencies, err = parseLatencyRecorder(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.errAccount, err = parseErrorAccounting(cfgMap, d.retryPolicy.MaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	d.serverStats, err = parseServerStats(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.waitEvents, err = parseWaitEvents(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.local, err = parseLocalSettings(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.txModes, err = parseTxModes(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	replicas, err := parseReplicas(cfgMap)
+	if err != nil {
+		return err
+	}
+
+	d.replicationLag, err = parseReplicationLag(cfgMap, replicas)
+	if err != nil {
+		return err
+	}
+
+	d.retryPolicy.RetryableErr = d.errAccount.Retryable
+
+	initialized := false
+
+	defer func() {
+		if !initialized {
+			d.release(ctx)
+		}
+	}()
+
 	connPool, err := pool.NewPool(
 		ctx,
-		runContext.GetGlobalConfig().GetRun().GetDriver(),
+		driverConfig,
 		d.logger.Named(pool.LoggerName),
 	)
 	if err != nil {
@@ -61,14 +189,47 @@ func (d *Driver) Initialize(ctx context.Context, runContext *stroppy.StepContext
 	}
 
 	d.pgxPool = connPool
+	d.failover = connPool.Failover()
+	d.tlsStats = connPool.TLSStats()
 
 	d.builder, err = queries.NewQueryBuilder(runContext)
 	if err != nil {
 		return err
 	}
 
-	d.txManager = manager.Must(trmpgx.NewDefaultFactory(connPool))
-	d.txExecutor = NewTxExecutor(connPool)
+	primary := newPoolTarget(connPool)
+	d.txManager = primary.txManager
+	d.txExecutor = primary.txExecutor
+	d.connector = primary.connector
+
+	d.replicas, err = newReplicaRouter(ctx, connPool, driverConfig, replicas, d.logger.Named(pool.LoggerName))
+	if err != nil {
+		return err
+	}
+
+	err = d.startLagMonitor(ctx, connPool, connPool.ApplicationName())
+	if err != nil {
+		return err
+	}
+
+	err = d.serverStats.Start(ctx, connPool, d.logger)
+	if err != nil {
+		return err
+	}
+
+	if d.waitEvents != nil {
+		d.waitSampler = pgstat.NewWaitSampler(connPool, connPool.ApplicationName(), d.waitEvents.interval, d.logger)
+		d.waitSampler.Start()
+	}
+
+	d.latencies.Start(d.logger)
+
+	d.metrics, err = newMetricsServer(cfgMap, d)
+	if err != nil {
+		return err
+	}
+
+	initialized = true
 
 	return nil
 }
@@ -96,46 +257,222 @@ func (d *Driver) RunTransaction(
 	ctx context.Context,
 	transaction *stroppy.DriverTransaction,
 ) error {
-	if transaction.GetIsolationLevel() == stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_UNSPECIFIED {
-		return d.runTransactionInternal(ctx, transaction, d.pgxPool)
+	start := time.Now()
+
+	err := d.retryPolicy.Do(ctx, d.logger, func(ctx context.Context) error {
+		err := d.runTransactionOnce(ctx, transaction)
+		d.errAccount.Count(transaction, err)
+
+		return err
+	})
+
+	d.latencies.RecordTransaction(transaction, time.Since(start))
+
+	return d.errAccount.Handle(err)
+}
+
+// observeFailover tells the failover monitor about outages and the first transaction after them.
+func (d *Driver) observeFailover(err error) {
+	switch {
+	case d.failover == nil:
+	case err == nil:
+		d.failover.Succeeded()
+	case errors.Is(err, context.Canceled):
+	default:
+		if class := ClassifyError(err); class == ErrorClassConnection || class == ErrorClassReadOnly {
+			d.failover.Failed(err)
+		}
+	}
+}
+
+// runTransactionOnce runs read-only transactions on a replica if there are any, the rest on the primary.
+func (d *Driver) runTransactionOnce(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+) error {
+	mode := d.txModes.For(transaction)
+
+	if replica := d.replicas.Route(transaction, mode); replica != nil {
+		return replica.run(func() error {
+			return d.runTransactionOn(ctx, transaction, mode, replica.poolTarget)
+		})
+	}
+
+	err := d.runTransactionOn(ctx, transaction, mode, d.primary())
+	d.observeFailover(err)
+
+	return err
+}
+
+func (d *Driver) primary() poolTarget {
+	return poolTarget{pool: d.pgxPool, txManager: d.txManager, txExecutor: d.txExecutor, connector: d.connector}
+}
+
+func (d *Driver) runTransactionOn(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	mode TxMode,
+	target poolTarget,
+) error {
+	if d.connMode == ConnectionModePerTransaction && target.connector != nil {
+		return d.runTransactionOnNewConn(ctx, transaction, mode, target.connector)
+	}
+
+	if queries.IsCopyTransaction(transaction) {
+		return d.runTransactionCopy(ctx, transaction, target.pool)
+	}
+
+	if d.execMode == TransactionExecModeBatch {
+		return d.runTransactionBatchOn(ctx, transaction, mode, target.pool)
+	}
+
+	if !d.explicitTransaction(transaction, mode) {
+		if d.prepared {
+			return d.runTransactionPrepared(ctx, transaction, target.pool)
+		}
+
+		return d.runTransactionInternal(ctx, transaction, target.pool)
+	}
+
+	txSettings, err := NewStroppyIsolationSettings(transaction, mode)
+	if err != nil {
+		return err
 	}
 
-	return d.txManager.DoWithSettings(
+	return target.txManager.DoWithSettings(
 		ctx,
-		NewStroppyIsolationSettings(transaction),
+		txSettings,
 		func(ctx context.Context) error {
-			return d.runTransactionInternal(ctx, transaction, d.txExecutor)
+			return d.runTransactionInternal(ctx, transaction, target.txExecutor)
 		})
 }
 
+// explicitTransaction reports whether the transaction needs BEGIN/COMMIT:
+// it has an isolation level or mode, or SET LOCAL overrides which have no effect outside of a transaction.
+// Retried multi-query transactions need it too, otherwise queries autocommitted before the failure run twice.
+func (d *Driver) explicitTransaction(transaction *stroppy.DriverTransaction, mode TxMode) bool {
+	return transaction.GetIsolationLevel() != stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_UNSPECIFIED ||
+		!mode.isZero() ||
+		d.local.Applies(transaction) ||
+		d.retryPolicy.MaxAttempts > 1 && len(transaction.GetQueries()) > 1
+}
+
 func (d *Driver) runTransactionInternal(
 	ctx context.Context,
 	transaction *stroppy.DriverTransaction,
 	executor Executor,
 ) error {
+	if err := setLocal(ctx, executor, d.local.forTransaction(transaction)); err != nil {
+		return err
+	}
+
 	for _, query := range transaction.GetQueries() {
-		values := make([]any, len(query.GetParams()))
+		ctx := pool.WithQueryName(ctx, query.GetName())
+
+		if err := setLocal(ctx, executor, d.local.forQuery(transaction, query)); err != nil {
+			return queryError(query, err)
+		}
+
+		d.registerWaitQuery(query.GetRequest(), query.GetName())
+
+		values, err := d.queryValues(query)
+		if err != nil {
+			return err
+		}
+
+		sql := query.GetRequest()
 
-		for i, v := range query.GetParams() {
-			val, err := d.builder.ValueToPgxValue(v)
+		if d.prepared {
+			sql, err = prepare(ctx, executor, query)
 			if err != nil {
-				return err
+				return queryError(query, err)
 			}
+		}
+
+		var rows int64
+
+		start := time.Now()
+
+		if d.readResults {
+			rows, err = queryAndDrain(ctx, executor, sql, values...)
+		} else {
+			var tag pgconn.CommandTag
 
-			values[i] = val
+			tag, err = executor.Exec(ctx, sql, values...)
+			rows = tag.RowsAffected()
 		}
 
-		_, err := executor.Exec(ctx, query.GetRequest(), values...)
+		d.latencies.RecordQuery(query, time.Since(start))
+
 		if err != nil {
-			return err
+			return queryError(query, err)
+		}
+
+		if err = d.validator.Check(query, rows); err != nil {
+			return queryError(query, err)
 		}
 	}
 
 	return nil
 }
 
-func (d *Driver) Teardown(_ context.Context) error {
+func (d *Driver) queryValues(query *stroppy.DriverQuery) ([]any, error) {
+	values := make([]any, len(query.GetParams()))
+
+	for i, v := range query.GetParams() {
+		val, err := d.builder.ValueToPgxValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = val
+	}
+
+	return values, nil
+}
+
+func (d *Driver) Teardown(ctx context.Context) error {
+	d.retryPolicy.LogStats(d.logger)
+	d.validator.LogStats(d.logger)
+	d.errAccount.LogStats(d.logger)
+	d.tlsStats.LogStats(d.logger)
+	d.replicas.LogStats(d.logger)
+
+	lagErr := d.stopLagMonitor(ctx)
+	failoverErr := d.failover.Stop()
+	waitsErr := d.stopWaitSampler()
+	statsErr := d.serverStats.Stop(ctx, d.pgxPool, d.logger)
+	metricsErr := d.metrics.Close()
+
+	// NOTE: replicas share tracers of the primary pool, so they are closed first.
+	d.replicas.Close()
 	d.pgxPool.Close()
 
-	return nil
+	return errors.Join(lagErr, failoverErr, waitsErr, statsErr, metricsErr, d.latencies.Stop(d.logger))
+}
+
+// release stops what Initialize has started so far without writing reports, when Initialize fails.
+func (d *Driver) release(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+
+	if d.lagMonitor != nil {
+		d.lagMonitor.Stop(ctx)
+	}
+
+	if d.waitSampler != nil {
+		d.waitSampler.Stop()
+	}
+
+	d.latencies.stopLogging()
+
+	if err := d.metrics.Close(); err != nil {
+		d.logger.Warn("failed to close metrics server", zap.Error(err))
+	}
+
+	d.replicas.Close()
+
+	if d.pgxPool != nil {
+		d.pgxPool.Close()
+	}
 }
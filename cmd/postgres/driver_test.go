@@ -4,11 +4,17 @@ import (
 	"context"
 	"testing"
 
+	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stroppy-io/stroppy-core/pkg/logger"
 	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
 )
 
 type testDriver struct {
@@ -18,8 +24,11 @@ type testDriver struct {
 func newTestDriver(mockPool pgxmock.PgxPoolIface) *testDriver {
 	return &testDriver{
 		Driver: &Driver{
-			logger:  logger.Global(),
-			pgxPool: mockPool,
+			logger:      logger.Global(),
+			pgxPool:     mockPool,
+			retryPolicy: NewRetryPolicy(),
+			latencies:   NewLatencyRecorder(),
+			errAccount:  NewErrorAccounting(),
 		},
 	}
 }
@@ -49,3 +58,346 @@ func TestDriver_RunQuery(t *testing.T) {
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDriver_RunTransaction_Retry(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.retryPolicy.MaxAttempts = 3
+	drv.retryPolicy.BaseDelay = 0
+	drv.retryPolicy.MaxDelay = 0
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{
+				Name:    "test_query",
+				Request: "UPDATE t SET v = 1",
+			},
+		},
+	}
+
+	mock.ExpectExec("UPDATE t").WillReturnError(&pgconn.PgError{Code: "40001"})
+	mock.ExpectExec("UPDATE t").WillReturnError(&pgconn.PgError{Code: "40P01"})
+	mock.ExpectExec("UPDATE t").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	err = drv.RunTransaction(ctx, query)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Equal(t, uint64(3), drv.retryPolicy.stats.Attempts.Load())
+	require.Equal(t, uint64(2), drv.retryPolicy.stats.Retries.Load())
+	require.Equal(t, map[ErrorClass]uint64{
+		ErrorClassSerialization: 1,
+		ErrorClassDeadlock:      1,
+	}, drv.errAccount.Counts(), "retried errors are counted")
+}
+
+func TestDriver_RunTransaction_RetryMultiQuery(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.txManager = manager.Must(trmpgx.NewDefaultFactory(mock))
+	drv.txExecutor = NewTxExecutor(mock)
+	drv.retryPolicy.MaxAttempts = 2
+	drv.retryPolicy.BaseDelay = 0
+	drv.retryPolicy.MaxDelay = 0
+
+	ctx := context.Background()
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "insert", Request: "INSERT INTO history VALUES (1)"},
+			{Name: "update", Request: "UPDATE accounts SET balance = 0"},
+		},
+	}
+
+	// the failed attempt is rolled back, so the insert is applied once
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO history").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("UPDATE accounts").WillReturnError(&pgconn.PgError{Code: "40P01"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO history").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("UPDATE accounts").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, drv.RunTransaction(ctx, transaction))
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Equal(t, uint64(1), drv.retryPolicy.stats.Retries.Load())
+}
+
+func TestParseTransactionExecMode(t *testing.T) {
+	mode, err := parseTransactionExecMode(map[string]any{}, true, true)
+	require.NoError(t, err)
+	require.Equal(t, TransactionExecModeSequential, mode)
+
+	mode, err = parseTransactionExecMode(map[string]any{transactionExecModeKey: "batch"}, false, false)
+	require.NoError(t, err)
+	require.Equal(t, TransactionExecModeBatch, mode)
+
+	_, err = parseTransactionExecMode(map[string]any{transactionExecModeKey: "batch"}, true, false)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseTransactionExecMode(map[string]any{transactionExecModeKey: "batch"}, false, true)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseTransactionExecMode(map[string]any{transactionExecModeKey: "pipeline"}, false, false)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
+
+func TestDriver_RunTransaction_Batch(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.execMode = TransactionExecModeBatch
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		IsolationLevel: stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE,
+		Queries: []*stroppy.DriverQuery{
+			{Name: "q1", Request: "UPDATE t SET v = 1"},
+			{Name: "q2", Request: "UPDATE t SET v = 2"},
+		},
+	}
+
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("begin isolation level serializable").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("UPDATE t SET v = 1").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	batch.ExpectExec("UPDATE t SET v = 2").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+
+	err = drv.runTransactionBatch(ctx, query, mock.AsConn())
+	require.NoError(t, err)
+
+	// the failed transaction is rolled back, so the connection is not destroyed
+	query.Queries = query.GetQueries()[:1]
+
+	batch = mock.ExpectBatch()
+	batch.ExpectExec("begin isolation level serializable").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("UPDATE t SET v = 1").WillReturnError(&pgconn.PgError{Code: "40001"})
+	batch.ExpectExec("COMMIT").WillReturnError(&pgconn.PgError{Code: "25P02"})
+	mock.ExpectExec("ROLLBACK").WillReturnResult(pgxmock.NewResult("ROLLBACK", 0))
+
+	err = drv.runTransactionBatch(ctx, query, mock.AsConn())
+	require.ErrorContains(t, err, "q1")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_RunTransaction_BatchRowsMismatch(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.execMode = TransactionExecModeBatch
+	drv.validator, err = parseResultValidator(map[string]any{expectedRowsKey: "q1=1"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		IsolationLevel: stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE,
+		Queries: []*stroppy.DriverQuery{
+			{Name: "q1", Request: "UPDATE t SET v = 1"},
+			{Name: "q2", Request: "UPDATE t SET v = 2"},
+		},
+	}
+
+	// COMMIT is not queued, it is sent after rows are checked
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("begin isolation level serializable").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("UPDATE t SET v = 1").WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	batch.ExpectExec("UPDATE t SET v = 2").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("ROLLBACK").WillReturnResult(pgxmock.NewResult("ROLLBACK", 0))
+
+	err = drv.runTransactionBatch(ctx, query, mock.AsConn())
+	require.ErrorIs(t, err, ErrUnexpectedRows)
+
+	batch = mock.ExpectBatch()
+	batch.ExpectExec("begin isolation level serializable").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("UPDATE t SET v = 1").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	batch.ExpectExec("UPDATE t SET v = 2").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+
+	require.NoError(t, drv.runTransactionBatch(ctx, query, mock.AsConn()))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_RunTransaction_Copy(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "load", Request: "/* stroppy:copy */ COPY public.t (id, name) FROM STDIN"},
+			{Name: "load", Request: "/* stroppy:copy */ COPY public.t (id, name) FROM STDIN"},
+		},
+	}
+
+	mock.ExpectCopyFrom(pgx.Identifier{"public", "t"}, []string{"id", "name"}).WillReturnResult(2)
+
+	err = drv.RunTransaction(ctx, query)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCopyFromSQL(t *testing.T) {
+	require.Equal(t, `copy "public"."t" ( "id", "Na""me" ) from stdin binary;`,
+		copyFromSQL(pgx.Identifier{"public", "t"}, []string{"id", `Na"me`}))
+}
+
+func TestDriver_RunTransaction_Prepared(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.prepared = true
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "test_query", Request: "SELECT 1"},
+		},
+	}
+	name := statementName(query.GetQueries()[0])
+	require.Regexp(t, "^test_query_[0-9a-f]{8}$", name)
+
+	mock.ExpectPrepare(name, "SELECT 1")
+	mock.ExpectExec(name).WillReturnResult(pgxmock.NewResult("SELECT", 1))
+
+	err = drv.runTransactionInternal(ctx, query, mock.AsConn())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_RunTransaction_ReadResults(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.readResults = true
+	drv.validator, err = parseResultValidator(map[string]any{expectedRowsKey: "test_query=2"})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "test_query", Request: "SELECT id FROM t"},
+		},
+	}
+
+	mock.ExpectQuery("SELECT id FROM t").WillReturnRows(
+		mock.NewRows([]string{"id"}).AddRow(int32(1)).AddRow(int32(2)),
+	)
+	require.NoError(t, drv.RunTransaction(ctx, query))
+
+	mock.ExpectQuery("SELECT id FROM t").WillReturnRows(
+		mock.NewRows([]string{"id"}).AddRow(int32(1)),
+	)
+	require.ErrorIs(t, drv.RunTransaction(ctx, query), ErrUnexpectedRows)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_RunTransaction_RowsMismatchCount(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.validator, err = parseResultValidator(map[string]any{
+		expectedRowsKey: "test_query=1",
+		rowsMismatchKey: rowsMismatchCount,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "test_query", Request: "UPDATE t SET a = 1"},
+		},
+	}
+
+	mock.ExpectExec("UPDATE t").WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	require.NoError(t, drv.RunTransaction(ctx, query))
+	require.Equal(t, uint64(1), drv.validator.anomalies["test_query"])
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_RunTransaction_ErrorPolicy(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.errAccount, err = parseErrorAccounting(map[string]any{
+		errorPolicyKey: "unique_violation=count,lock_timeout=retry",
+	}, 2)
+	require.NoError(t, err)
+
+	drv.retryPolicy.MaxAttempts = 2
+	drv.retryPolicy.BaseDelay = 0
+	drv.retryPolicy.MaxDelay = 0
+	drv.retryPolicy.RetryableErr = drv.errAccount.Retryable
+
+	ctx := context.Background()
+	query := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "insert_item", Request: "INSERT INTO t VALUES (1)"},
+		},
+	}
+
+	mock.ExpectExec("INSERT INTO t").WillReturnError(&pgconn.PgError{Code: "23505"})
+	require.NoError(t, drv.RunTransaction(ctx, query))
+
+	mock.ExpectExec("INSERT INTO t").WillReturnError(&pgconn.PgError{Code: "55P03"})
+	mock.ExpectExec("INSERT INTO t").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	require.NoError(t, drv.RunTransaction(ctx, query))
+
+	mock.ExpectExec("INSERT INTO t").WillReturnError(&pgconn.PgError{Code: "23503"})
+	err = drv.RunTransaction(ctx, query)
+
+	var queryErr *QueryError
+
+	require.ErrorAs(t, err, &queryErr)
+	require.Equal(t, "insert_item", queryErr.Query)
+
+	require.Equal(t, map[ErrorClass]uint64{
+		ErrorClassUnique:      1,
+		ErrorClassLockTimeout: 1,
+		ErrorClassForeignKey:  1,
+	}, drv.errAccount.Counts(), "retried attempts are counted too")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDriver_Initialize_ReleasesOnError(t *testing.T) {
+	drv := &Driver{logger: logger.Global()}
+
+	err := drv.Initialize(context.Background(), &stroppy.StepContext{
+		GlobalConfig: &stroppy.Config{Run: &stroppy.RunConfig{Driver: &stroppy.DriverConfig{
+			Url: "postgres://stroppy@127.0.0.1:1/bench?connect_timeout=1",
+			DbSpecific: &stroppy.Value_Struct{Fields: []*stroppy.Value{
+				{Type: &stroppy.Value_String_{String_: "1h"}, Key: latencyLogIntervalKey},
+				{Type: &stroppy.Value_String_{String_: "1h"}, Key: waitEventSampleIntervalKey},
+				{Type: &stroppy.Value_String_{String_: "256.0.0.1:0"}, Key: metricsAddressKey},
+			}},
+		}}},
+		Step: &stroppy.StepDescriptor{Name: "test"},
+	})
+	require.ErrorContains(t, err, "listen")
+
+	_, err = drv.pgxPool.Acquire(context.Background())
+	require.ErrorContains(t, err, "closed pool")
+	require.Nil(t, drv.latencies.stop, "latency logging is stopped")
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// error_policy maps error classes to policies, as "class=policy,class=policy" string or struct.
+const errorPolicyKey = "error_policy"
+
+type ErrorClass string
+
+const (
+	ErrorClassSerialization ErrorClass = "serialization_failure"
+	ErrorClassDeadlock      ErrorClass = "deadlock_detected"
+	ErrorClassUnique        ErrorClass = "unique_violation"
+	ErrorClassForeignKey    ErrorClass = "foreign_key_violation"
+	ErrorClassNotNull       ErrorClass = "not_null_violation"
+	ErrorClassCheck         ErrorClass = "check_violation"
+	ErrorClassLockTimeout   ErrorClass = "lock_timeout"
+	ErrorClassQueryCanceled ErrorClass = "query_canceled"
+	ErrorClassConnection    ErrorClass = "connection"
+	ErrorClassReadOnly      ErrorClass = "read_only_transaction"
+	ErrorClassOther         ErrorClass = "other"
+)
+
+const (
+	sqlStateUniqueViolation     = "23505"
+	sqlStateForeignKeyViolation = "23503"
+	sqlStateNotNullViolation    = "23502"
+	sqlStateCheckViolation      = "23514"
+	sqlStateLockNotAvailable    = "55P03"
+	sqlStateQueryCanceled       = "57014"
+	sqlStateReadOnlyTransaction = "25006"
+	sqlStateAdminShutdown       = "57P01"
+	sqlStateCrashShutdown       = "57P02"
+	sqlStateCannotConnectNow    = "57P03"
+	// sqlStateClassConnection is the class of "08xxx" connection exception codes.
+	sqlStateClassConnection = "08"
+)
+
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyFail stops the run with the error.
+	ErrorPolicyFail ErrorPolicy = "fail"
+	// ErrorPolicyCount counts the error and reports the transaction as done.
+	ErrorPolicyCount ErrorPolicy = "count"
+	// ErrorPolicyRetry retries the transaction under RetryPolicy and fails when attempts are exhausted,
+	// in addition to SQLSTATEs of the policy.
+	ErrorPolicyRetry ErrorPolicy = "retry"
+)
+
+var errorClasses = []ErrorClass{
+	ErrorClassSerialization,
+	ErrorClassDeadlock,
+	ErrorClassUnique,
+	ErrorClassForeignKey,
+	ErrorClassNotNull,
+	ErrorClassCheck,
+	ErrorClassLockTimeout,
+	ErrorClassQueryCanceled,
+	ErrorClassConnection,
+	ErrorClassReadOnly,
+	ErrorClassOther,
+}
+
+// QueryError attributes an error to the DriverQuery which caused it.
+type QueryError struct {
+	Query string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query %s: %v", e.Query, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func queryError(query *stroppy.DriverQuery, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &QueryError{Query: query.GetName(), Err: err}
+}
+
+// ClassifyError maps error to its class by SQLSTATE,
+// errors without SQLSTATE are either connection errors or other.
+func ClassifyError(err error) ErrorClass {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err) {
+		return ErrorClassConnection
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return ErrorClassConnection
+	}
+
+	return ErrorClassOther
+}
+
+func classifySQLState(code string) ErrorClass {
+	switch code {
+	case sqlStateSerializationFailure:
+		return ErrorClassSerialization
+	case sqlStateDeadlockDetected:
+		return ErrorClassDeadlock
+	case sqlStateUniqueViolation:
+		return ErrorClassUnique
+	case sqlStateForeignKeyViolation:
+		return ErrorClassForeignKey
+	case sqlStateNotNullViolation:
+		return ErrorClassNotNull
+	case sqlStateCheckViolation:
+		return ErrorClassCheck
+	case sqlStateLockNotAvailable:
+		return ErrorClassLockTimeout
+	case sqlStateQueryCanceled:
+		return ErrorClassQueryCanceled
+	case sqlStateAdminShutdown, sqlStateCrashShutdown, sqlStateCannotConnectNow:
+		return ErrorClassConnection
+	case sqlStateReadOnlyTransaction:
+		return ErrorClassReadOnly
+	}
+
+	if strings.HasPrefix(code, sqlStateClassConnection) {
+		return ErrorClassConnection
+	}
+
+	return ErrorClassOther
+}
+
+type errorCountKey struct {
+	class ErrorClass
+	query string
+}
+
+// ErrorAccounting applies the policy of error class to transaction errors
+// and counts them per class and per query name. Every class fails the run by default.
+type ErrorAccounting struct {
+	policies map[ErrorClass]ErrorPolicy
+
+	mu     sync.Mutex
+	counts map[errorCountKey]uint64
+}
+
+func NewErrorAccounting() *ErrorAccounting {
+	policies := make(map[ErrorClass]ErrorPolicy, len(errorClasses))
+	for _, class := range errorClasses {
+		policies[class] = ErrorPolicyFail
+	}
+
+	return &ErrorAccounting{
+		policies: policies,
+		counts:   make(map[errorCountKey]uint64),
+	}
+}
+
+// parseErrorAccounting rejects the retry policy when maxAttempts of the retry policy leaves no retries.
+func parseErrorAccounting(cfgMap map[string]any, maxAttempts int) (*ErrorAccounting, error) {
+	accounting := NewErrorAccounting()
+
+	rawAny, exists := cfgMap[errorPolicyKey]
+	if !exists {
+		return accounting, nil
+	}
+
+	policies, err := parseNamedValues(errorPolicyKey, rawAny)
+	if err != nil {
+		return nil, err
+	}
+
+	supportedPolicies := []ErrorPolicy{ErrorPolicyFail, ErrorPolicyCount, ErrorPolicyRetry}
+
+	for classStr, policyStr := range policies {
+		class := ErrorClass(classStr)
+		if !slices.Contains(errorClasses, class) {
+			return nil, fmt.Errorf(`"%v" invalid class for "%s" key; supported values are %v: %w`,
+				classStr, errorPolicyKey, errorClasses, pool.ErrUnsupportedParam)
+		}
+
+		policy := ErrorPolicy(policyStr)
+		if !slices.Contains(supportedPolicies, policy) {
+			return nil, fmt.Errorf(`"%v" invalid policy for "%s" key; supported values are %v: %w`,
+				policyStr, errorPolicyKey, supportedPolicies, pool.ErrUnsupportedParam)
+		}
+
+		if policy == ErrorPolicyRetry && maxAttempts <= 1 {
+			return nil, fmt.Errorf(`"%s" policy of "%s" class requires "%s" greater than 1, got %d: %w`,
+				policy, class, retryMaxAttemptsKey, maxAttempts, pool.ErrUnsupportedParam)
+		}
+
+		accounting.policies[class] = policy
+	}
+
+	return accounting, nil
+}
+
+// Retryable reports whether err class has the retry policy.
+func (a *ErrorAccounting) Retryable(err error) bool {
+	return a.policies[ClassifyError(err)] == ErrorPolicyRetry
+}
+
+// Count counts the error of a transaction attempt, so attempts failed before a retry are counted too.
+func (a *ErrorAccounting) Count(transaction *stroppy.DriverTransaction, err error) {
+	if err == nil {
+		return
+	}
+
+	query := transactionLabel(transaction)
+
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		query = queryErr.Query
+	}
+
+	a.mu.Lock()
+	a.counts[errorCountKey{class: ClassifyError(err), query: query}]++
+	a.mu.Unlock()
+}
+
+// Handle returns nil if the class of the transaction error has the count policy.
+func (a *ErrorAccounting) Handle(err error) error {
+	if err == nil || a.policies[ClassifyError(err)] == ErrorPolicyCount {
+		return nil
+	}
+
+	return err
+}
+
+// Counts returns numbers of errors by class.
+func (a *ErrorAccounting) Counts() map[ErrorClass]uint64 {
+	counts := make(map[ErrorClass]uint64)
+	for key, count := range a.snapshot() {
+		counts[key.class] += count
+	}
+
+	return counts
+}
+
+// snapshot returns numbers of errors by class and query name.
+func (a *ErrorAccounting) snapshot() map[errorCountKey]uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return maps.Clone(a.counts)
+}
+
+func (a *ErrorAccounting) LogStats(logger *zap.Logger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys := slices.SortedFunc(maps.Keys(a.counts), func(a, b errorCountKey) int {
+		if c := strings.Compare(string(a.class), string(b.class)); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.query, b.query)
+	})
+
+	for _, key := range keys {
+		logger.Info("transaction errors",
+			zap.String("class", string(key.class)),
+			zap.String("policy", string(a.policies[key.class])),
+			zap.String("query", key.query),
+			zap.Uint64("count", a.counts[key]),
+		)
+	}
+}
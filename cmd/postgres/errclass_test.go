@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{&pgconn.PgError{Code: "40001"}, ErrorClassSerialization},
+		{&pgconn.PgError{Code: "40P01"}, ErrorClassDeadlock},
+		{&pgconn.PgError{Code: "23505"}, ErrorClassUnique},
+		{&pgconn.PgError{Code: "23503"}, ErrorClassForeignKey},
+		{&pgconn.PgError{Code: "23502"}, ErrorClassNotNull},
+		{&pgconn.PgError{Code: "23514"}, ErrorClassCheck},
+		{&pgconn.PgError{Code: "55P03"}, ErrorClassLockTimeout},
+		{&pgconn.PgError{Code: "57014"}, ErrorClassQueryCanceled},
+		{&pgconn.PgError{Code: "08006"}, ErrorClassConnection},
+		{&pgconn.PgError{Code: "57P01"}, ErrorClassConnection},
+		{&pgconn.PgError{Code: "25006"}, ErrorClassReadOnly},
+		{&pgconn.PgError{Code: "42P01"}, ErrorClassOther},
+		{fmt.Errorf("wrapped: %w", &QueryError{Query: "q", Err: &pgconn.PgError{Code: "23505"}}), ErrorClassUnique},
+		{io.ErrUnexpectedEOF, ErrorClassConnection},
+		{errors.New("boom"), ErrorClassOther}, //nolint: err113 // test
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.class, ClassifyError(tt.err), tt.err.Error())
+	}
+}
+
+func TestParseErrorAccounting(t *testing.T) {
+	accounting, err := parseErrorAccounting(map[string]any{}, 1)
+	require.NoError(t, err)
+
+	for _, class := range errorClasses {
+		require.Equal(t, ErrorPolicyFail, accounting.policies[class])
+	}
+
+	accounting, err = parseErrorAccounting(map[string]any{
+		errorPolicyKey: map[string]any{"unique_violation": "count", "connection": "retry"},
+	}, 3)
+	require.NoError(t, err)
+	require.Equal(t, ErrorPolicyCount, accounting.policies[ErrorClassUnique])
+	require.Equal(t, ErrorPolicyRetry, accounting.policies[ErrorClassConnection])
+	require.True(t, accounting.Retryable(io.EOF))
+	require.False(t, accounting.Retryable(&pgconn.PgError{Code: "23505"}))
+
+	_, err = parseErrorAccounting(map[string]any{errorPolicyKey: "unique=count"}, 1)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseErrorAccounting(map[string]any{errorPolicyKey: "unique_violation=ignore"}, 1)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseErrorAccounting(map[string]any{errorPolicyKey: "serialization_failure=retry"}, 1)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam, "retry without retries")
+}
+
+func TestErrorAccounting_Handle(t *testing.T) {
+	accounting, err := parseErrorAccounting(map[string]any{errorPolicyKey: "unique_violation=count"}, 1)
+	require.NoError(t, err)
+
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "a"}, {Name: "b"}},
+	}
+
+	uniqueErr := &QueryError{Query: "b", Err: &pgconn.PgError{Code: "23505"}}
+	otherErr := &pgconn.PgError{Code: "42P01"}
+
+	accounting.Count(transaction, nil)
+	accounting.Count(transaction, uniqueErr)
+	accounting.Count(transaction, otherErr)
+
+	require.NoError(t, accounting.Handle(nil))
+	require.NoError(t, accounting.Handle(uniqueErr))
+	require.ErrorIs(t, accounting.Handle(otherErr), otherErr)
+
+	require.Equal(t, map[errorCountKey]uint64{
+		{class: ErrorClassUnique, query: "b"}:  1,
+		{class: ErrorClassOther, query: "a+b"}: 1,
+	}, accounting.counts)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
@@ -19,6 +20,44 @@ type Executor interface {
 	// - pgconn.CommandTag: The command tag returned by the execution.
 	// - error: An error if the execution fails.
 	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	// Query executes the given SQL statement and returns rows to be read by the caller.
+	//
+	// Parameters:
+	// - ctx: The context.Context object.
+	// - sql: The SQL statement to execute.
+	// - args: The arguments to be passed to the SQL statement.
+	//
+	// Returns:
+	// - pgx.Rows: The result rows, they must be closed by the caller.
+	// - error: An error if the execution fails.
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+type BatchExecutor interface {
+	// SendBatch sends all queued queries to the server at once.
+	//
+	// Parameters:
+	// - ctx: The context.Context object.
+	// - b: The batch of queued queries.
+	//
+	// Returns:
+	// - pgx.BatchResults: The results reader, it must be closed by the caller.
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+type CopyFromExecutor interface {
+	// CopyFrom streams rows to the table using COPY protocol.
+	//
+	// Parameters:
+	// - ctx: The context.Context object.
+	// - tableName: The target table.
+	// - columnNames: The target columns in the rows order.
+	// - rowSrc: The rows source.
+	//
+	// Returns:
+	// - int64: The number of copied rows.
+	// - error: An error if the copy fails.
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
 }
 
 type ctxGetter interface {
@@ -34,7 +73,10 @@ type ctxGetter interface {
 	DefaultTrOrDB(ctx context.Context, db trmpgx.Tr) trmpgx.Tr
 }
 
-var _ Executor = (*TxExecutor)(nil)
+var (
+	_ Executor = (*TxExecutor)(nil)
+	_ Preparer = (*TxExecutor)(nil)
+)
 
 type TxExecutor struct {
 	defaultTr trmpgx.Tr
@@ -99,3 +141,43 @@ func (e *TxExecutor) Exec(
 
 	return tag, nil
 }
+
+// Query executes the given SQL statement with the provided arguments in the context of the TxExecutor.
+//
+// Parameters:
+// - ctx: The context.Context object.
+// - sql: The SQL statement to execute.
+// - args: The arguments to be passed to the SQL statement.
+//
+// Returns:
+// - pgx.Rows: The result rows, they must be closed by the caller.
+// - error: An error if the execution fails.
+func (e *TxExecutor) Query(
+	ctx context.Context,
+	sql string,
+	args ...interface{},
+) (pgx.Rows, error) {
+	return e.tr(ctx).Query(ctx, sql, args...)
+}
+
+// Prepare creates a prepared statement on the connection of the transaction from the context.
+//
+// Parameters:
+// - ctx: The context.Context object.
+// - name: The statement name.
+// - sql: The SQL statement to prepare.
+//
+// Returns:
+// - *pgconn.StatementDescription: The prepared statement description.
+// - error: ErrPrepareUnsupported if there is no transaction in the context.
+func (e *TxExecutor) Prepare(
+	ctx context.Context,
+	name, sql string,
+) (*pgconn.StatementDescription, error) {
+	preparer, ok := e.tr(ctx).(Preparer)
+	if !ok {
+		return nil, ErrPrepareUnsupported
+	}
+
+	return preparer.Prepare(ctx, name, sql)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
 	"github.com/avito-tech/go-transaction-manager/trm/v2/settings"
@@ -11,10 +13,13 @@ import (
 )
 
 func NewSettings(level pgx.TxIsoLevel, opts ...settings.Opt) *trmpgx.Settings {
+	return NewTxSettings(pgx.TxOptions{IsoLevel: level}, opts...)
+}
+
+// NewTxSettings begins transaction with the full set of options.
+func NewTxSettings(txOptions pgx.TxOptions, opts ...settings.Opt) *trmpgx.Settings {
 	setts := trmpgx.MustSettings(settings.Must(opts...),
-		trmpgx.WithTxOptions(pgx.TxOptions{
-			IsoLevel: level,
-		}),
+		trmpgx.WithTxOptions(txOptions),
 	)
 
 	return &setts
@@ -38,17 +43,58 @@ func SerializableSettings(opts ...settings.Opt) *trmpgx.Settings {
 
 var ErrUnsupportedIsolationLevel = errors.New("unsupported isolation level")
 
-func NewStroppyIsolationSettings(transaction *stroppy.DriverTransaction, opts ...settings.Opt) *trmpgx.Settings {
+// NewStroppyIsolationSettings maps transaction isolation level and mode to the transaction options,
+// unspecified isolation level leaves the server default.
+func NewStroppyIsolationSettings(
+	transaction *stroppy.DriverTransaction,
+	mode TxMode,
+	opts ...settings.Opt,
+) (*trmpgx.Settings, error) {
+	var level pgx.TxIsoLevel
+
 	switch transaction.GetIsolationLevel() {
+	case stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_UNSPECIFIED:
 	case stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_READ_UNCOMMITTED:
-		return ReadUncommittedSettings(opts...)
+		level = pgx.ReadUncommitted
 	case stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_READ_COMMITTED:
-		return ReadCommittedSettings(opts...)
+		level = pgx.ReadCommitted
 	case stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_REPEATABLE_READ:
-		return RepeatableReadSettings(opts...)
+		level = pgx.RepeatableRead
 	case stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE:
-		return SerializableSettings(opts...)
+		level = pgx.Serializable
 	default:
-		panic(ErrUnsupportedIsolationLevel)
+		return nil, fmt.Errorf("%d: %w", transaction.GetIsolationLevel(), ErrUnsupportedIsolationLevel)
+	}
+
+	return NewTxSettings(pgx.TxOptions{
+		IsoLevel:       level,
+		AccessMode:     mode.AccessMode,
+		DeferrableMode: mode.DeferrableMode,
+		BeginQuery:     mode.BeginQuery,
+	}, opts...), nil
+}
+
+// beginSQL renders BEGIN statement for the given options the same way pgx does in BeginTx.
+func beginSQL(opts pgx.TxOptions) string {
+	if opts.BeginQuery != "" {
+		return opts.BeginQuery
+	}
+
+	var buf strings.Builder
+
+	buf.WriteString("begin")
+
+	if opts.IsoLevel != "" {
+		buf.WriteString(" isolation level " + string(opts.IsoLevel))
+	}
+
+	if opts.AccessMode != "" {
+		buf.WriteString(" " + string(opts.AccessMode))
+	}
+
+	if opts.DeferrableMode != "" {
+		buf.WriteString(" " + string(opts.DeferrableMode))
 	}
+
+	return buf.String()
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pgstat"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// replication_lag_interval enables replication lag sampling with the given interval,
+// replication_lag_method is "heartbeat" (default with "replica_urls") or "pg_stat_replication",
+// replication_lag_table is the heartbeat table created on the primary,
+// replication_lag_report is a file the lag time series is written to at Teardown.
+const (
+	replicationLagIntervalKey = "replication_lag_interval"
+	replicationLagMethodKey   = "replication_lag_method"
+	replicationLagTableKey    = "replication_lag_table"
+	replicationLagReportKey   = "replication_lag_report"
+)
+
+const (
+	defaultReplicationLagTable   = "stroppy_heartbeat"
+	replicationLagReportFileMode = 0o644
+)
+
+type replicationLagConfig struct {
+	interval   time.Duration
+	method     pgstat.LagMethod
+	table      string
+	reportPath string
+}
+
+// parseReplicationLag returns nil when "replication_lag_interval" is not set.
+// The heartbeat method needs replicas to read the heartbeat on.
+func parseReplicationLag(cfgMap map[string]any, replicas *replicaConfig) (*replicationLagConfig, error) {
+	rawAny, exists := cfgMap[replicationLagIntervalKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // sampling is disabled
+	}
+
+	interval, ok := config.Duration(rawAny)
+	if !ok {
+		return nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`,
+			replicationLagIntervalKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf(`"%s" must be positive, got %v: %w`,
+			replicationLagIntervalKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	cfg := &replicationLagConfig{
+		interval: interval,
+		method:   pgstat.LagMethodStatReplication,
+		table:    defaultReplicationLagTable,
+	}
+
+	if replicas != nil {
+		cfg.method = pgstat.LagMethodHeartbeat
+	}
+
+	if rawAny, exists := cfgMap[replicationLagMethodKey]; exists {
+		rawStr, _ := config.String(rawAny)
+
+		switch method := pgstat.LagMethod(rawStr); method {
+		case pgstat.LagMethodHeartbeat, pgstat.LagMethodStatReplication:
+			cfg.method = method
+		default:
+			return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+				rawAny, replicationLagMethodKey,
+				[]pgstat.LagMethod{pgstat.LagMethodHeartbeat, pgstat.LagMethodStatReplication},
+				pool.ErrUnsupportedParam,
+			)
+		}
+	}
+
+	if cfg.method == pgstat.LagMethodHeartbeat && replicas == nil {
+		return nil, fmt.Errorf(`"%s" method of "%s" requires "%s": %w`,
+			pgstat.LagMethodHeartbeat, replicationLagMethodKey, replicaURLsKey, pool.ErrUnsupportedParam)
+	}
+
+	if rawAny, exists := cfgMap[replicationLagTableKey]; exists {
+		if cfg.table, ok = config.String(rawAny); !ok || cfg.table == "" {
+			return nil, fmt.Errorf(`"%s" must be a non-empty string, got %v: %w`,
+				replicationLagTableKey, rawAny, pool.ErrUnsupportedParam)
+		}
+	}
+
+	if rawAny, exists := cfgMap[replicationLagReportKey]; exists {
+		if cfg.reportPath, ok = config.String(rawAny); !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+				replicationLagReportKey, rawAny, pool.ErrUnsupportedParam)
+		}
+	}
+
+	return cfg, nil
+}
+
+// startLagMonitor samples the lag of the router replicas, the heartbeat row is keyed by application_name.
+func (d *Driver) startLagMonitor(ctx context.Context, primary pgstat.Executor, applicationName string) error {
+	if d.replicationLag == nil {
+		return nil
+	}
+
+	var replicas []pgstat.LagReplica
+
+	if d.replicas != nil {
+		for _, replica := range d.replicas.replicas {
+			replicas = append(replicas, pgstat.LagReplica{Name: replica.name, Querier: replica.pool})
+		}
+	}
+
+	d.lagMonitor = pgstat.NewLagMonitor(
+		primary,
+		replicas,
+		d.replicationLag.method,
+		d.replicationLag.interval,
+		d.replicationLag.table,
+		applicationName,
+		d.logger.Named("replication_lag"),
+	)
+
+	return d.lagMonitor.Start(ctx)
+}
+
+// stopLagMonitor logs the lag summary and writes the time series to the report file if set.
+func (d *Driver) stopLagMonitor(ctx context.Context) error {
+	if d.lagMonitor == nil {
+		return nil
+	}
+
+	report := d.lagMonitor.Stop(ctx)
+
+	for name, series := range report.Replicas {
+		d.logger.Info("replication lag",
+			zap.String("replica", name),
+			zap.Int("samples", len(series.Points)),
+			zap.Duration("max", series.Max),
+			zap.Duration("mean", series.Mean))
+	}
+
+	if d.replicationLag.reportPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.replicationLag.reportPath, data, replicationLagReportFileMode)
+}
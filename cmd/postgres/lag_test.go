@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pgstat"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseReplicationLag(t *testing.T) {
+	replicas := &replicaConfig{names: []string{"r1"}}
+
+	cfg, err := parseReplicationLag(map[string]any{}, replicas)
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	cfg, err = parseReplicationLag(map[string]any{
+		replicationLagIntervalKey: "500ms",
+		replicationLagReportKey:   "lag.json",
+	}, replicas)
+	require.NoError(t, err)
+	require.Equal(t, &replicationLagConfig{
+		interval:   500 * time.Millisecond,
+		method:     pgstat.LagMethodHeartbeat,
+		table:      defaultReplicationLagTable,
+		reportPath: "lag.json",
+	}, cfg)
+
+	cfg, err = parseReplicationLag(map[string]any{
+		replicationLagIntervalKey: "1s",
+		replicationLagTableKey:    "hb",
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, pgstat.LagMethodStatReplication, cfg.method)
+	require.Equal(t, "hb", cfg.table)
+
+	_, err = parseReplicationLag(map[string]any{
+		replicationLagIntervalKey: "1s",
+		replicationLagMethodKey:   "heartbeat",
+	}, nil)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseReplicationLag(map[string]any{
+		replicationLagIntervalKey: "1s",
+		replicationLagMethodKey:   "ping",
+	}, replicas)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseReplicationLag(map[string]any{replicationLagIntervalKey: "-1s"}, replicas)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseReplicationLag(map[string]any{
+		replicationLagIntervalKey: "1s",
+		replicationLagTableKey:    "",
+	}, replicas)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/stats"
+)
+
+// latency_report_path is a file the JSON latency report is written to at Teardown,
+// latency_log_interval enables periodic logging of the same report.
+const (
+	latencyReportPathKey  = "latency_report_path"
+	latencyLogIntervalKey = "latency_log_interval"
+)
+
+const latencyReportFileMode = 0o644
+
+// LatencyRecorder keeps latency histograms of queries by DriverQuery name,
+// of whole transactions by transactionLabel and of connect and close in per-transaction connection mode.
+type LatencyRecorder struct {
+	queries      *stats.Registry
+	transactions *stats.Registry
+	connections  *stats.Registry
+
+	reportPath  string
+	logInterval time.Duration
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// LatencyReport is the JSON document written at Teardown.
+type LatencyReport struct {
+	Queries      map[string]stats.Summary `json:"queries"`
+	Transactions map[string]stats.Summary `json:"transactions"`
+	Connections  map[string]stats.Summary `json:"connections,omitempty"`
+}
+
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{
+		queries:      stats.NewRegistry(),
+		transactions: stats.NewRegistry(),
+		connections:  stats.NewRegistry(),
+	}
+}
+
+func parseLatencyRecorder(cfgMap map[string]any) (*LatencyRecorder, error) {
+	recorder := NewLatencyRecorder()
+
+	if rawAny, exists := cfgMap[latencyReportPathKey]; exists {
+		rawStr, ok := config.String(rawAny)
+		if !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+				latencyReportPathKey, rawAny, pool.ErrUnsupportedParam)
+		}
+
+		recorder.reportPath = rawStr
+	}
+
+	if rawAny, exists := cfgMap[latencyLogIntervalKey]; exists {
+		interval, ok := config.Duration(rawAny)
+		if !ok {
+			return nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`,
+				latencyLogIntervalKey, rawAny, pool.ErrUnsupportedParam)
+		}
+
+		if interval <= 0 {
+			return nil, fmt.Errorf(`"%s" must be positive, got %v: %w`,
+				latencyLogIntervalKey, rawAny, pool.ErrUnsupportedParam)
+		}
+
+		recorder.logInterval = interval
+	}
+
+	return recorder, nil
+}
+
+// transactionLabel names DriverTransaction, which has no name of its own,
+// by distinct names of its queries in order of appearance.
+func transactionLabel(transaction *stroppy.DriverTransaction) string {
+	names := make([]string, 0, len(transaction.GetQueries()))
+
+	for _, query := range transaction.GetQueries() {
+		if !slices.Contains(names, query.GetName()) {
+			names = append(names, query.GetName())
+		}
+	}
+
+	return strings.Join(names, "+")
+}
+
+func (r *LatencyRecorder) RecordQuery(query *stroppy.DriverQuery, d time.Duration) {
+	r.queries.Histogram(query.GetName()).Record(d)
+}
+
+func (r *LatencyRecorder) RecordTransaction(transaction *stroppy.DriverTransaction, d time.Duration) {
+	r.transactions.Histogram(transactionLabel(transaction)).Record(d)
+}
+
+// RecordConnection records duration of the connection phase, "connect" or "close".
+func (r *LatencyRecorder) RecordConnection(phase string, d time.Duration) {
+	r.connections.Histogram(phase).Record(d)
+}
+
+func (r *LatencyRecorder) Report() LatencyReport {
+	return LatencyReport{
+		Queries:      r.queries.Summaries(),
+		Transactions: r.transactions.Summaries(),
+		Connections:  r.connections.Summaries(),
+	}
+}
+
+// Start logs the report every logInterval until Stop, it does nothing if the interval is not set.
+func (r *LatencyRecorder) Start(logger *zap.Logger) {
+	if r.logInterval == 0 {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+
+	go func() {
+		defer close(r.stopped)
+
+		ticker := time.NewTicker(r.logInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				logger.Info("latency report", zap.Any("report", r.Report()))
+			}
+		}
+	}()
+}
+
+// stopLogging stops periodic reports started by Start.
+func (r *LatencyRecorder) stopLogging() {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.stopped
+		r.stop = nil
+	}
+}
+
+// Stop stops periodic logging, logs the final report and writes it to the report file if set.
+func (r *LatencyRecorder) Stop(logger *zap.Logger) error {
+	r.stopLogging()
+
+	report := r.Report()
+	logger.Info("latency report", zap.Any("report", report))
+
+	if r.reportPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.reportPath, data, latencyReportFileMode)
+}
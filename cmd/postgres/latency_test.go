@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseLatencyRecorder(t *testing.T) {
+	recorder, err := parseLatencyRecorder(map[string]any{})
+	require.NoError(t, err)
+	require.Empty(t, recorder.reportPath)
+	require.Zero(t, recorder.logInterval)
+
+	recorder, err = parseLatencyRecorder(map[string]any{
+		latencyReportPathKey:  "/tmp/latency.json",
+		latencyLogIntervalKey: "10s",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/latency.json", recorder.reportPath)
+	require.Equal(t, 10*time.Second, recorder.logInterval)
+
+	_, err = parseLatencyRecorder(map[string]any{latencyReportPathKey: int32(1)})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseLatencyRecorder(map[string]any{latencyLogIntervalKey: "-1s"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseLatencyRecorder(map[string]any{latencyLogIntervalKey: "often"})
+	require.Error(t, err)
+}
+
+func TestTransactionLabel(t *testing.T) {
+	require.Equal(t, "new_order+payment", transactionLabel(&stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "new_order"}, {Name: "payment"}, {Name: "new_order"}},
+	}))
+	require.Empty(t, transactionLabel(&stroppy.DriverTransaction{}))
+}
+
+func TestDriver_RunTransaction_Latencies(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+
+	drv := newTestDriver(mock)
+	drv.latencies.reportPath = filepath.Join(t.TempDir(), "latency.json")
+	drv.latencies.logInterval = time.Millisecond
+	drv.latencies.Start(logger.Global())
+
+	ctx := context.Background()
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "select_one", Request: "SELECT 1"},
+			{Name: "select_two", Request: "SELECT 2"},
+		},
+	}
+
+	mock.ExpectExec("SELECT 1").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("SELECT 2").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	require.NoError(t, drv.RunTransaction(ctx, transaction))
+
+	mock.ExpectClose()
+	require.NoError(t, drv.Teardown(ctx))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	data, err := os.ReadFile(drv.latencies.reportPath)
+	require.NoError(t, err)
+
+	var report map[string]map[string]map[string]int64
+
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Equal(t, int64(1), report["queries"]["select_one"]["count"])
+	require.Equal(t, int64(1), report["queries"]["select_two"]["count"])
+	require.Equal(t, int64(1), report["transactions"]["select_one+select_two"]["count"])
+}
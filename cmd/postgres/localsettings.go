@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// local_settings are GUCs set with SET LOCAL semantics, keyed by transaction label or query name:
+// struct of "name=value;name=value" strings or "target:name=value;target:name=value" string.
+// Settings of a transaction label are applied right after BEGIN, settings of a query right before it,
+// both last until the end of the transaction.
+const localSettingsKey = "local_settings"
+
+type localSetting struct {
+	name  string
+	value string
+}
+
+// LocalSettings are per-transaction and per-query GUC overrides.
+type LocalSettings map[string][]localSetting
+
+func parseLocalSettings(cfgMap map[string]any) (LocalSettings, error) {
+	rawAny, exists := cfgMap[localSettingsKey]
+	if !exists {
+		return nil, nil
+	}
+
+	local := make(LocalSettings)
+
+	addPairs := func(target, pairs string) error {
+		for _, pair := range strings.Split(pairs, ";") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return fmt.Errorf(`"%s" of "%s" must be name=value: %w`,
+					pair, localSettingsKey, pool.ErrUnsupportedParam)
+			}
+
+			local[target] = append(local[target], localSetting{
+				name:  strings.ToLower(strings.TrimSpace(name)),
+				value: strings.TrimSpace(value),
+			})
+		}
+
+		return nil
+	}
+
+	switch raw := rawAny.(type) {
+	case map[string]any:
+		for target, pairs := range raw {
+			if err := addPairs(target, fmt.Sprint(pairs)); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		for _, entry := range strings.Split(raw, ";") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+
+			target, pair, ok := strings.Cut(entry, ":")
+			if !ok {
+				return nil, fmt.Errorf(`"%s" of "%s" must be target:name=value: %w`,
+					entry, localSettingsKey, pool.ErrUnsupportedParam)
+			}
+
+			if err := addPairs(strings.TrimSpace(target), pair); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf(`"%s" must be a struct or a string, got %v: %w`,
+			localSettingsKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	return local, nil
+}
+
+// Applies reports whether the transaction or any of its queries has overrides,
+// such transactions must run in an explicit transaction.
+func (l LocalSettings) Applies(transaction *stroppy.DriverTransaction) bool {
+	if len(l) == 0 {
+		return false
+	}
+
+	if _, ok := l[transactionLabel(transaction)]; ok {
+		return true
+	}
+
+	for _, query := range transaction.GetQueries() {
+		if _, ok := l[query.GetName()]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l LocalSettings) forTransaction(transaction *stroppy.DriverTransaction) []localSetting {
+	return l[transactionLabel(transaction)]
+}
+
+// forQuery skips the query settings already applied as the transaction settings.
+func (l LocalSettings) forQuery(transaction *stroppy.DriverTransaction, query *stroppy.DriverQuery) []localSetting {
+	if query.GetName() == transactionLabel(transaction) {
+		return nil
+	}
+
+	return l[query.GetName()]
+}
+
+// setLocalSQL renders one statement applying all settings with set_config(name, value, true).
+func setLocalSQL(settings []localSetting) (string, []any) {
+	calls := make([]string, len(settings))
+	args := make([]any, 0, 2*len(settings)) //nolint: mnd // name and value
+
+	for i, setting := range settings {
+		calls[i] = "set_config($" + strconv.Itoa(2*i+1) + ", $" + strconv.Itoa(2*i+2) + ", true)" //nolint: mnd // pairs
+		args = append(args, setting.name, setting.value)
+	}
+
+	return "SELECT " + strings.Join(calls, ", "), args
+}
+
+func setLocal(ctx context.Context, executor Executor, settings []localSetting) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	sql, args := setLocalSQL(settings)
+
+	_, err := executor.Exec(ctx, sql, args...)
+
+	return err
+}
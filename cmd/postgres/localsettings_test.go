@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseLocalSettings(t *testing.T) {
+	local, err := parseLocalSettings(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, local)
+
+	local, err = parseLocalSettings(map[string]any{
+		localSettingsKey: "insert_audit:synchronous_commit=off; report:work_mem=256MB;report:JIT=off",
+	})
+	require.NoError(t, err)
+	require.Equal(t, LocalSettings{
+		"insert_audit": {{name: "synchronous_commit", value: "off"}},
+		"report":       {{name: "work_mem", value: "256MB"}, {name: "jit", value: "off"}},
+	}, local)
+
+	local, err = parseLocalSettings(map[string]any{
+		localSettingsKey: map[string]any{"insert_audit": "synchronous_commit=off;lock_timeout=1s"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, LocalSettings{
+		"insert_audit": {{name: "synchronous_commit", value: "off"}, {name: "lock_timeout", value: "1s"}},
+	}, local)
+
+	_, err = parseLocalSettings(map[string]any{localSettingsKey: "synchronous_commit=off"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseLocalSettings(map[string]any{localSettingsKey: "q:synchronous_commit"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
+
+func TestLocalSettings_Targets(t *testing.T) {
+	local := LocalSettings{
+		"payment":      {{name: "synchronous_commit", value: "on"}},
+		"insert_audit": {{name: "synchronous_commit", value: "off"}},
+	}
+
+	single := &stroppy.DriverTransaction{Queries: []*stroppy.DriverQuery{{Name: "payment"}}}
+	require.True(t, local.Applies(single))
+	require.Len(t, local.forTransaction(single), 1)
+	require.Empty(t, local.forQuery(single, single.GetQueries()[0]))
+
+	mixed := &stroppy.DriverTransaction{Queries: []*stroppy.DriverQuery{{Name: "new_order"}, {Name: "insert_audit"}}}
+	require.True(t, local.Applies(mixed))
+	require.Empty(t, local.forTransaction(mixed))
+	require.Equal(t, local["insert_audit"], local.forQuery(mixed, mixed.GetQueries()[1]))
+
+	require.False(t, local.Applies(&stroppy.DriverTransaction{Queries: []*stroppy.DriverQuery{{Name: "other"}}}))
+	require.False(t, LocalSettings(nil).Applies(single))
+
+	sql, args := setLocalSQL(local["payment"])
+	require.Equal(t, "SELECT set_config($1, $2, true)", sql)
+	require.Equal(t, []any{"synchronous_commit", "on"}, args)
+}
+
+func TestDriver_RunTransaction_LocalSettings(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.txManager = manager.Must(trmpgx.NewDefaultFactory(mock))
+	drv.txExecutor = NewTxExecutor(mock)
+	drv.local = LocalSettings{"insert_audit": {{name: "synchronous_commit", value: "off"}}}
+
+	ctx := context.Background()
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{
+			{Name: "new_order", Request: "UPDATE t SET v = 1"},
+			{Name: "insert_audit", Request: "INSERT INTO audit VALUES (1)"},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE t SET v = 1").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("SELECT set_config").WithArgs("synchronous_commit", "off").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	require.NoError(t, drv.RunTransaction(ctx, transaction))
+
+	drv.execMode = TransactionExecModeBatch
+
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("begin").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("UPDATE t SET v = 1").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	batch.ExpectExec("SELECT set_config").WithArgs("synchronous_commit", "off").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	batch.ExpectExec("INSERT INTO audit").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+	require.NoError(t, drv.runTransactionBatch(ctx, transaction, mock.AsConn()))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
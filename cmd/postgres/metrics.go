@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/stats"
+)
+
+// metrics_address enables Prometheus HTTP listener on the given address, e.g. ":9187",
+// metrics_path overrides the default "/metrics" path.
+const (
+	metricsAddressKey = "metrics_address"
+	metricsPathKey    = "metrics_path"
+)
+
+const (
+	defaultMetricsPath     = "/metrics"
+	metricsNamespace       = "stroppy_postgres"
+	metricsReadTimeout     = 10 * time.Second
+	metricsShutdownTimeout = 5 * time.Second
+	// primaryPoolLabel is the "pool" label of primary pool metrics, replica pools are labeled with replica names.
+	primaryPoolLabel = "primary"
+)
+
+var metricsQuantiles = []float64{0.5, 0.95, 0.99} //nolint: mnd // reported quantiles
+
+// MetricsServer serves driver metrics in Prometheus format during the run.
+type MetricsServer struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// newMetricsServer starts the listener if "metrics_address" is set, otherwise nil server is returned.
+func newMetricsServer(cfgMap map[string]any, driver *Driver) (*MetricsServer, error) {
+	rawAny, exists := cfgMap[metricsAddressKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // metrics are disabled
+	}
+
+	address, ok := config.String(rawAny)
+	if !ok {
+		return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+			metricsAddressKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	path := defaultMetricsPath
+	if rawAny, exists := cfgMap[metricsPathKey]; exists {
+		path, ok = config.String(rawAny)
+		if !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+				metricsPathKey, rawAny, pool.ErrUnsupportedParam)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newDriverCollector(driver),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := &MetricsServer{
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: metricsReadTimeout},
+		listener: listener,
+	}
+
+	go func() {
+		if err := metrics.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			driver.logger.Error("metrics server stopped", zap.Error(err))
+		}
+	}()
+
+	driver.logger.Info("serving metrics", zap.String("address", listener.Addr().String()), zap.String("path", path))
+
+	return metrics, nil
+}
+
+func (m *MetricsServer) Close() error {
+	if m == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+
+	return m.server.Shutdown(ctx)
+}
+
+// driverCollector reads pool statistics and driver counters on every scrape.
+type driverCollector struct {
+	driver *Driver
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	emptyAcquireWait     *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+	lifetimeDestroyCount *prometheus.Desc
+	idleDestroyCount     *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+
+	queryDuration       *prometheus.Desc
+	transactionDuration *prometheus.Desc
+	connectionDuration  *prometheus.Desc
+	transactionErrors   *prometheus.Desc
+	transactionAttempts *prometheus.Desc
+	transactionRetries  *prometheus.Desc
+
+	connections     *prometheus.Desc
+	connectionSetup *prometheus.Desc
+
+	failovers        *prometheus.Desc
+	failoverDowntime *prometheus.Desc
+	failoverDown     *prometheus.Desc
+
+	replicaTransactions *prometheus.Desc
+	replicaErrors       *prometheus.Desc
+	replicationLag      *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*driverCollector)(nil)
+
+func newDriverCollector(driver *Driver) *driverCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", name), help, labels, nil)
+	}
+
+	return &driverCollector{
+		driver: driver,
+
+		acquireCount:         desc("pool_acquire_total", "Successful connection acquires from the pool.", "pool"),
+		acquireDuration:      desc("pool_acquire_duration_seconds_total", "Total time spent in successful acquires.", "pool"),
+		emptyAcquireCount:    desc("pool_empty_acquire_total", "Acquires which waited for a connection.", "pool"),
+		emptyAcquireWait:     desc("pool_empty_acquire_wait_seconds_total", "Total time waited in empty acquires.", "pool"),
+		canceledAcquireCount: desc("pool_canceled_acquire_total", "Acquires canceled by context.", "pool"),
+		newConnsCount:        desc("pool_new_conns_total", "Connections opened by the pool.", "pool"),
+		lifetimeDestroyCount: desc("pool_max_lifetime_destroy_total", "Connections closed by max_conn_lifetime.", "pool"),
+		idleDestroyCount:     desc("pool_max_idle_destroy_total", "Connections closed by max_conn_idle_time.", "pool"),
+		acquiredConns:        desc("pool_acquired_conns", "Connections currently acquired.", "pool"),
+		constructingConns:    desc("pool_constructing_conns", "Connections currently being opened.", "pool"),
+		idleConns:            desc("pool_idle_conns", "Connections currently idle.", "pool"),
+		totalConns:           desc("pool_total_conns", "Connections currently in the pool.", "pool"),
+		maxConns:             desc("pool_max_conns", "Maximum size of the pool.", "pool"),
+
+		queryDuration:       desc("query_duration_seconds", "Query latency by query name.", "query"),
+		transactionDuration: desc("transaction_duration_seconds", "Transaction latency by transaction label.", "transaction"),
+		connectionDuration:  desc("connection_duration_seconds", "Connect and close latency by phase.", "phase"),
+		transactionErrors:   desc("transaction_errors_total", "Transaction errors by class and query name.", "class", "query"),
+		transactionAttempts: desc("transaction_attempts_total", "Transaction attempts including retries."),
+		transactionRetries:  desc("transaction_retries_total", "Transaction retries."),
+
+		connections:     desc("connections_total", "Pool connections by TLS version.", "tls_version", "cipher"),
+		connectionSetup: desc("connection_setup_seconds_total", "Total connection setup time.", "tls_version", "cipher"),
+
+		failovers:        desc("failovers_total", "Finished outages of the server."),
+		failoverDowntime: desc("failover_downtime_seconds_total", "Total time of finished outages."),
+		failoverDown:     desc("failover_down", "1 while an outage is in progress."),
+
+		replicaTransactions: desc("replica_transactions_total", "Read-only transactions run on the replica.", "replica"),
+		replicaErrors:       desc("replica_errors_total", "Failed transactions run on the replica.", "replica"),
+		replicationLag:      desc("replication_lag_seconds", "Latest sampled replication lag.", "replica"),
+	}
+}
+
+func (c *driverCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *driverCollector) Collect(ch chan<- prometheus.Metric) {
+	counter := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+	}
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	c.collectPool(ch, primaryPoolLabel, c.driver.pgxPool.Stat())
+
+	if c.driver.replicas != nil {
+		for _, replica := range c.driver.replicas.replicas {
+			c.collectPool(ch, replica.name, replica.pool.Stat())
+		}
+	}
+
+	collectSummaries(ch, c.queryDuration, c.driver.latencies.queries)
+	collectSummaries(ch, c.transactionDuration, c.driver.latencies.transactions)
+	collectSummaries(ch, c.connectionDuration, c.driver.latencies.connections)
+
+	for key, count := range c.driver.errAccount.snapshot() {
+		counter(c.transactionErrors, float64(count), string(key.class), key.query)
+	}
+
+	counter(c.transactionAttempts, float64(c.driver.retryPolicy.stats.Attempts.Load()))
+	counter(c.transactionRetries, float64(c.driver.retryPolicy.stats.Retries.Load()))
+
+	for _, item := range c.driver.tlsStats.Summary() {
+		counter(c.connections, float64(item.Connections), item.Version, item.Cipher)
+		counter(c.connectionSetup, item.Setup.Seconds(), item.Version, item.Cipher)
+	}
+
+	if c.driver.failover != nil {
+		events := c.driver.failover.Events()
+
+		var downtime time.Duration
+		for _, event := range events {
+			downtime += event.Downtime
+		}
+
+		down := 0.0
+		if c.driver.failover.Down() {
+			down = 1
+		}
+
+		counter(c.failovers, float64(len(events)))
+		counter(c.failoverDowntime, downtime.Seconds())
+		gauge(c.failoverDown, down)
+	}
+
+	if c.driver.replicas != nil {
+		for _, replica := range c.driver.replicas.replicas {
+			counter(c.replicaTransactions, float64(replica.transactions.Load()), replica.name)
+			counter(c.replicaErrors, float64(replica.errors.Load()), replica.name)
+		}
+	}
+
+	if c.driver.lagMonitor != nil {
+		for name, lag := range c.driver.lagMonitor.Last() {
+			gauge(c.replicationLag, lag.Seconds(), name)
+		}
+	}
+}
+
+// collectPool sends statistics of the primary or a replica pool labeled with the pool name.
+func (c *driverCollector) collectPool(ch chan<- prometheus.Metric, name string, stat *pgxpool.Stat) {
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, name)
+	}
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, name)
+	}
+
+	counter(c.acquireCount, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquireCount, float64(stat.EmptyAcquireCount()))
+	counter(c.emptyAcquireWait, stat.EmptyAcquireWaitTime().Seconds())
+	counter(c.canceledAcquireCount, float64(stat.CanceledAcquireCount()))
+	counter(c.newConnsCount, float64(stat.NewConnsCount()))
+	counter(c.lifetimeDestroyCount, float64(stat.MaxLifetimeDestroyCount()))
+	counter(c.idleDestroyCount, float64(stat.MaxIdleDestroyCount()))
+	gauge(c.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(c.constructingConns, float64(stat.ConstructingConns()))
+	gauge(c.idleConns, float64(stat.IdleConns()))
+	gauge(c.totalConns, float64(stat.TotalConns()))
+	gauge(c.maxConns, float64(stat.MaxConns()))
+}
+
+func collectSummaries(ch chan<- prometheus.Metric, desc *prometheus.Desc, registry *stats.Registry) {
+	for name, hist := range registry.Histograms() {
+		summary := hist.Summary()
+		quantiles := make(map[float64]float64, len(metricsQuantiles))
+
+		for _, q := range metricsQuantiles {
+			quantiles[q] = hist.Quantile(q).Seconds()
+		}
+
+		ch <- prometheus.MustNewConstSummary(desc, summary.Count, summary.Sum.Seconds(), quantiles, name)
+	}
+}
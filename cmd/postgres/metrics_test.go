@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// statPool replaces Stat of pgxmock pool, which panics, with Stat of a pool which never connects.
+type statPool struct {
+	pgxmock.PgxPoolIface
+	pool *pgxpool.Pool
+}
+
+func (p *statPool) Stat() *pgxpool.Stat {
+	return p.pool.Stat()
+}
+
+func TestNewMetricsServer(t *testing.T) {
+	metrics, err := newMetricsServer(map[string]any{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, metrics)
+	require.NoError(t, metrics.Close())
+
+	_, err = newMetricsServer(map[string]any{metricsAddressKey: int32(9187)}, nil)
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
+
+func TestMetricsServer_Scrape(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	lazyPool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db")
+	require.NoError(t, err)
+	defer lazyPool.Close()
+
+	drv := newTestDriver(mock)
+	drv.pgxPool = &statPool{PgxPoolIface: mock, pool: lazyPool}
+	drv.replicas = &ReplicaRouter{replicas: []*Replica{{
+		poolTarget: poolTarget{pool: &statPool{PgxPoolIface: mock, pool: lazyPool}},
+		name:       "r1",
+	}}}
+
+	metrics, err := newMetricsServer(map[string]any{
+		metricsAddressKey: "127.0.0.1:0",
+		metricsPathKey:    "/stats",
+	}, drv.Driver)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, metrics.Close()) }()
+
+	transaction := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "insert_item", Request: "INSERT INTO t VALUES (1)"}},
+	}
+
+	drv.latencies.RecordQuery(transaction.GetQueries()[0], time.Millisecond)
+	drv.latencies.RecordTransaction(transaction, 2*time.Millisecond)
+	drv.errAccount.Count(transaction, &QueryError{Query: "insert_item", Err: &pgconn.PgError{Code: "23505"}})
+
+	resp, err := http.Get("http://" + metrics.listener.Addr().String() + "/stats") //nolint: noctx // test
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, metric := range []string{
+		`stroppy_postgres_pool_acquire_total{pool="primary"} 0`,
+		`stroppy_postgres_pool_max_conns{pool="primary"}`,
+		`stroppy_postgres_pool_total_conns{pool="r1"} 0`,
+		`stroppy_postgres_replica_transactions_total{replica="r1"} 0`,
+		`stroppy_postgres_query_duration_seconds_count{query="insert_item"} 1`,
+		`stroppy_postgres_transaction_duration_seconds{transaction="insert_item",quantile="0.99"} 0.002`,
+		`stroppy_postgres_transaction_errors_total{class="unique_violation",query="insert_item"} 1`,
+		"stroppy_postgres_transaction_attempts_total 0",
+	} {
+		require.Contains(t, string(body), metric)
+	}
+}
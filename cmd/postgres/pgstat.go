@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pgstat"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// pg_stat_report enables server statistics snapshots at Initialize and Teardown,
+// their deltas are written to the given file.
+const (
+	pgStatReportKey        = "pg_stat_report"
+	pgStatTopStatementsKey = "pg_stat_top_statements"
+)
+
+const (
+	defaultPgStatTopStatements = 20
+	pgStatReportFileMode       = 0o644
+)
+
+// ServerStats keeps the first snapshot of the server statistics until Teardown.
+type ServerStats struct {
+	reportPath    string
+	topStatements int
+	before        *pgstat.Snapshot
+}
+
+// parseServerStats returns nil when "pg_stat_report" is not set.
+func parseServerStats(cfgMap map[string]any) (*ServerStats, error) {
+	rawAny, exists := cfgMap[pgStatReportKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // statistics are disabled
+	}
+
+	reportPath, ok := config.String(rawAny)
+	if !ok || reportPath == "" {
+		return nil, fmt.Errorf(`"%s" must be a file path, got %v: %w`,
+			pgStatReportKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	stats := &ServerStats{
+		reportPath:    reportPath,
+		topStatements: defaultPgStatTopStatements,
+	}
+
+	if rawAny, exists := cfgMap[pgStatTopStatementsKey]; exists {
+		top, ok := config.Int(rawAny)
+		if !ok || top < 0 {
+			return nil, fmt.Errorf(`"%s" must be a non-negative integer, got %v: %w`,
+				pgStatTopStatementsKey, rawAny, pool.ErrUnsupportedParam)
+		}
+
+		stats.topStatements = int(top)
+	}
+
+	return stats, nil
+}
+
+func (s *ServerStats) Start(ctx context.Context, querier pgstat.Querier, logger *zap.Logger) error {
+	if s == nil {
+		return nil
+	}
+
+	before, err := pgstat.Take(ctx, querier, logger)
+	if err != nil {
+		return err
+	}
+
+	s.before = before
+
+	return nil
+}
+
+// Stop takes the second snapshot and writes deltas report.
+func (s *ServerStats) Stop(ctx context.Context, querier pgstat.Querier, logger *zap.Logger) error {
+	if s == nil || s.before == nil {
+		return nil
+	}
+
+	after, err := pgstat.Take(ctx, querier, logger)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(pgstat.Diff(s.before, after, s.topStatements), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	logger.Info("server statistics report", zap.String("path", s.reportPath))
+
+	return os.WriteFile(s.reportPath, data, pgStatReportFileMode)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseServerStats(t *testing.T) {
+	stats, err := parseServerStats(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, stats)
+	require.NoError(t, stats.Stop(t.Context(), nil, nil))
+
+	stats, err = parseServerStats(map[string]any{
+		pgStatReportKey:        "/tmp/pg_stat.json",
+		pgStatTopStatementsKey: int32(5),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/pg_stat.json", stats.reportPath)
+	require.Equal(t, 5, stats.topStatements)
+
+	_, err = parseServerStats(map[string]any{pgStatReportKey: ""})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseServerStats(map[string]any{pgStatReportKey: "r.json", pgStatTopStatementsKey: int32(-1)})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// preparedStatementsKey enables explicit server-side statements for the sequential transaction exec mode:
+// every distinct DriverQuery is prepared lazily once per connection and executed by its name.
+const preparedStatementsKey = "prepared_statements"
+
+// maxStatementNameLen is NAMEDATALEN-1, longer names are truncated by the server.
+const maxStatementNameLen = 63
+
+var ErrPrepareUnsupported = errors.New("executor does not support prepared statements")
+
+type Preparer interface {
+	// Prepare creates a server-side prepared statement on the connection.
+	// It is idempotent for the same name and sql, so repeated calls cost a map lookup.
+	//
+	// Parameters:
+	// - ctx: The context.Context object.
+	// - name: The statement name.
+	// - sql: The SQL statement to prepare.
+	//
+	// Returns:
+	// - *pgconn.StatementDescription: The prepared statement description.
+	// - error: An error if the preparation fails.
+	Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error)
+}
+
+func parsePreparedStatements(cfgMap map[string]any) (bool, error) {
+	return parseBool(cfgMap, preparedStatementsKey)
+}
+
+func parseBool(cfgMap map[string]any, key string) (bool, error) {
+	rawAny, exists := cfgMap[key]
+	if !exists {
+		return false, nil
+	}
+
+	value, ok := config.Bool(rawAny)
+	if !ok {
+		return false, fmt.Errorf(`"%s" must be a bool, got %v: %w`, key, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	return value, nil
+}
+
+// statementName derives server-side statement name from the DriverQuery name.
+// SQL hash suffix keeps names distinct when the same query name has different SQL,
+// e.g. the last partial batch of multi-row insert.
+func statementName(query *stroppy.DriverQuery) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(query.GetRequest()))
+	suffix := fmt.Sprintf("_%08x", hash.Sum32())
+
+	name := query.GetName()
+	if len(name)+len(suffix) > maxStatementNameLen {
+		name = name[:maxStatementNameLen-len(suffix)]
+	}
+
+	return name + suffix
+}
+
+// prepare makes sure the query is prepared on the executor connection
+// and returns statement name to be executed instead of the query SQL.
+func prepare(ctx context.Context, executor Executor, query *stroppy.DriverQuery) (string, error) {
+	preparer, ok := executor.(Preparer)
+	if !ok {
+		return "", ErrPrepareUnsupported
+	}
+
+	name := statementName(query)
+
+	if _, err := preparer.Prepare(ctx, name, query.GetRequest()); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// runTransactionPrepared pins a pool connection for the transaction,
+// since prepared statements live on the connection they were created on.
+func (d *Driver) runTransactionPrepared(
+	ctx context.Context,
+	transaction *stroppy.DriverTransaction,
+	connPool ConnPool,
+) error {
+	conn, err := connPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return d.runTransactionInternal(ctx, transaction, conn.Conn())
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/queries"
+)
+
+const (
+	// replica_urls are connection URLs of replicas, as ";" separated string or struct of name to URL.
+	replicaURLsKey = "replica_urls"
+	// replica_balancing picks a replica for every read-only transaction,
+	// least_connections picks the replica running the fewest transactions of the driver.
+	replicaBalancingKey = "replica_balancing"
+	// replica_reads chooses which transactions go to replicas: declared read only (default)
+	// or also detected SELECT-only, a call of any function but known read-only built-ins counts as a write.
+	replicaReadsKey = "replica_reads"
+)
+
+type ReplicaBalancing string
+
+const (
+	ReplicaBalancingRoundRobin       ReplicaBalancing = "round_robin"
+	ReplicaBalancingLeastConnections ReplicaBalancing = "least_connections"
+)
+
+const (
+	// replicaReadsDetected routes declared read-only and SELECT-only transactions,
+	// detection is lexical, so it is opt-in.
+	replicaReadsDetected = "detected"
+	// replicaReadsDeclared routes only transactions declared READ ONLY in "transaction_modes".
+	replicaReadsDeclared = "declared"
+)
+
+// poolTarget is a pool with the transaction manager bound to it.
+type poolTarget struct {
+	pool       ConnPool
+	txManager  *manager.Manager
+	txExecutor *TxExecutor
+	// connector is nil when the pool cannot open connections outside of it.
+	connector Connector
+}
+
+// txPool is a pool transactions can be started on, e.g. *pool.Pool.
+type txPool interface {
+	ConnPool
+	trmpgx.Tr
+	trmpgx.Transactional
+}
+
+func newPoolTarget(connPool txPool) poolTarget {
+	connector, _ := connPool.(Connector)
+
+	return poolTarget{
+		pool:       connPool,
+		txManager:  manager.Must(trmpgx.NewDefaultFactory(connPool)),
+		txExecutor: NewTxExecutor(connPool),
+		connector:  connector,
+	}
+}
+
+// Replica is a replica pool with its routing counters.
+type Replica struct {
+	poolTarget
+
+	name         string
+	tlsStats     *pool.TLSStats
+	transactions atomic.Uint64
+	errors       atomic.Uint64
+	// running counts transactions in flight, pool stats do not see connections opened per transaction.
+	running atomic.Int64
+}
+
+// ReplicaRouter sends read-only transactions to replica pools, everything else stays on the primary.
+type ReplicaRouter struct {
+	replicas     []*Replica
+	balancing    ReplicaBalancing
+	declaredOnly bool
+	next         atomic.Uint64
+	// readOnlySQL caches ReadOnlyStatement results by SQL text.
+	readOnlySQL sync.Map
+}
+
+type replicaConfig struct {
+	urls         map[string]string
+	names        []string
+	balancing    ReplicaBalancing
+	declaredOnly bool
+}
+
+// parseReplicas returns nil when "replica_urls" is not set.
+func parseReplicas(cfgMap map[string]any) (*replicaConfig, error) {
+	rawAny, exists := cfgMap[replicaURLsKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // no replicas
+	}
+
+	cfg := &replicaConfig{
+		urls:         make(map[string]string),
+		balancing:    ReplicaBalancingRoundRobin,
+		declaredOnly: true,
+	}
+
+	addURL := func(name, url string) error {
+		url = strings.TrimSpace(url)
+
+		connConfig, err := pgconn.ParseConfig(url)
+		if err != nil {
+			return fmt.Errorf(`"%s" of "%s": %w`, name, replicaURLsKey, err)
+		}
+
+		if name == "" {
+			name = fmt.Sprintf("%s:%d", connConfig.Host, connConfig.Port)
+		}
+
+		if _, ok := cfg.urls[name]; ok {
+			return fmt.Errorf(`"%s" of "%s" is duplicated: %w`, name, replicaURLsKey, pool.ErrUnsupportedParam)
+		}
+
+		cfg.urls[name] = url
+		cfg.names = append(cfg.names, name)
+
+		return nil
+	}
+
+	switch raw := rawAny.(type) {
+	case map[string]any:
+		for name, urlAny := range raw {
+			if err := addURL(name, fmt.Sprint(urlAny)); err != nil {
+				return nil, err
+			}
+		}
+
+		slices.Sort(cfg.names)
+	case string:
+		for _, url := range strings.Split(raw, ";") {
+			if strings.TrimSpace(url) == "" {
+				continue
+			}
+
+			if err := addURL("", url); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf(`"%s" must be a struct or a string, got %v: %w`,
+			replicaURLsKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	if len(cfg.names) == 0 {
+		return nil, fmt.Errorf(`"%s" has no URLs: %w`, replicaURLsKey, pool.ErrUnsupportedParam)
+	}
+
+	if rawAny, exists := cfgMap[replicaBalancingKey]; exists {
+		rawStr, _ := config.String(rawAny)
+
+		switch balancing := ReplicaBalancing(rawStr); balancing {
+		case ReplicaBalancingRoundRobin, ReplicaBalancingLeastConnections:
+			cfg.balancing = balancing
+		default:
+			return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+				rawAny, replicaBalancingKey,
+				[]ReplicaBalancing{ReplicaBalancingRoundRobin, ReplicaBalancingLeastConnections},
+				pool.ErrUnsupportedParam,
+			)
+		}
+	}
+
+	if rawAny, exists := cfgMap[replicaReadsKey]; exists {
+		switch rawAny {
+		case replicaReadsDetected:
+			cfg.declaredOnly = false
+		case replicaReadsDeclared:
+			cfg.declaredOnly = true
+		default:
+			return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+				rawAny, replicaReadsKey,
+				[]string{replicaReadsDetected, replicaReadsDeclared},
+				pool.ErrUnsupportedParam,
+			)
+		}
+	}
+
+	return cfg, nil
+}
+
+// newReplicaRouter connects replica pools sharing tracers of the primary, nil router is returned without replicas.
+func newReplicaRouter(
+	ctx context.Context,
+	primary *pool.Pool,
+	driverConfig *stroppy.DriverConfig,
+	cfg *replicaConfig,
+	logger *zap.Logger,
+) (*ReplicaRouter, error) {
+	if cfg == nil {
+		return nil, nil //nolint: nilnil // no replicas
+	}
+
+	router := &ReplicaRouter{
+		balancing:    cfg.balancing,
+		declaredOnly: cfg.declaredOnly,
+	}
+
+	for _, name := range cfg.names {
+		replicaPool, err := pool.NewReplicaPool(ctx, primary, driverConfig, cfg.urls[name],
+			logger.With(zap.String("replica", name)))
+		if err != nil {
+			router.Close()
+
+			return nil, fmt.Errorf("replica %s: %w", name, err)
+		}
+
+		router.replicas = append(router.replicas, &Replica{
+			poolTarget: newPoolTarget(replicaPool),
+			name:       name,
+			tlsStats:   replicaPool.TLSStats(),
+		})
+	}
+
+	return router, nil
+}
+
+// Route returns the replica for a read-only transaction or nil if it must run on the primary.
+// SERIALIZABLE transactions stay on the primary, since standbys do not support them, and so does COPY.
+func (r *ReplicaRouter) Route(transaction *stroppy.DriverTransaction, mode TxMode) *Replica {
+	if r == nil ||
+		transaction.GetIsolationLevel() == stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE ||
+		mode.AccessMode == pgx.ReadWrite ||
+		queries.IsCopyTransaction(transaction) {
+		return nil
+	}
+
+	if mode.ReadOnly() || !r.declaredOnly && r.selectOnly(transaction) {
+		return r.pick()
+	}
+
+	return nil
+}
+
+// selectOnly reports whether all queries of the transaction only read.
+func (r *ReplicaRouter) selectOnly(transaction *stroppy.DriverTransaction) bool {
+	if len(transaction.GetQueries()) == 0 {
+		return false
+	}
+
+	for _, query := range transaction.GetQueries() {
+		sql := query.GetRequest()
+
+		readOnly, ok := r.readOnlySQL.Load(sql)
+		if !ok {
+			readOnly = pool.ReadOnlyStatement(sql)
+			r.readOnlySQL.Store(sql, readOnly)
+		}
+
+		if !readOnly.(bool) { //nolint: forcetypeassert // only bools are stored
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *ReplicaRouter) pick() *Replica {
+	start := int(r.next.Add(1) % uint64(len(r.replicas)))
+
+	if r.balancing != ReplicaBalancingLeastConnections {
+		return r.replicas[start]
+	}
+
+	// NOTE: scan starts at the round-robin position, so ties are spread between replicas.
+	picked := r.replicas[start]
+	least := picked.running.Load()
+
+	for i := 1; i < len(r.replicas); i++ {
+		replica := r.replicas[(start+i)%len(r.replicas)]
+
+		if running := replica.running.Load(); running < least {
+			picked, least = replica, running
+		}
+	}
+
+	return picked
+}
+
+// run runs the transaction on the replica and counts it.
+func (r *Replica) run(run func() error) error {
+	r.running.Add(1)
+	err := run()
+	r.running.Add(-1)
+
+	r.transactions.Add(1)
+
+	if err != nil {
+		r.errors.Add(1)
+	}
+
+	return err
+}
+
+func (r *ReplicaRouter) LogStats(logger *zap.Logger) {
+	if r == nil {
+		return
+	}
+
+	for _, replica := range r.replicas {
+		logger.Info("replica stats",
+			zap.String("replica", replica.name),
+			zap.Uint64("transactions", replica.transactions.Load()),
+			zap.Uint64("errors", replica.errors.Load()))
+		replica.tlsStats.LogStats(logger.With(zap.String("replica", replica.name)))
+	}
+}
+
+func (r *ReplicaRouter) Close() {
+	if r == nil {
+		return
+	}
+
+	for _, replica := range r.replicas {
+		replica.pool.Close()
+	}
+}
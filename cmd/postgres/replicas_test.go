@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseReplicas(t *testing.T) {
+	cfg, err := parseReplicas(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	cfg, err = parseReplicas(map[string]any{
+		replicaURLsKey: "postgres://u@replica1:5432/db; postgres://u@replica2:5433/db",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"replica1:5432", "replica2:5433"}, cfg.names)
+	require.Equal(t, ReplicaBalancingRoundRobin, cfg.balancing)
+	require.True(t, cfg.declaredOnly)
+
+	cfg, err = parseReplicas(map[string]any{
+		replicaURLsKey:      map[string]any{"b": "postgres://u@replica2/db", "a": "postgres://u@replica1/db"},
+		replicaBalancingKey: "least_connections",
+		replicaReadsKey:     "detected",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, cfg.names)
+	require.Equal(t, "postgres://u@replica1/db", cfg.urls["a"])
+	require.Equal(t, ReplicaBalancingLeastConnections, cfg.balancing)
+	require.False(t, cfg.declaredOnly)
+
+	for _, cfgMap := range []map[string]any{
+		{replicaURLsKey: ""},
+		{replicaURLsKey: int32(1)},
+		{replicaURLsKey: "postgres://u@r/db;postgres://u@r/db"},
+		{replicaURLsKey: "postgres://u@r/db", replicaBalancingKey: "random"},
+		{replicaURLsKey: "postgres://u@r/db", replicaReadsKey: "all"},
+	} {
+		_, err = parseReplicas(cfgMap)
+		require.ErrorIs(t, err, pool.ErrUnsupportedParam, cfgMap)
+	}
+}
+
+func TestReplicaRouter_Route(t *testing.T) {
+	r1, r2 := &Replica{name: "r1"}, &Replica{name: "r2"}
+	router := &ReplicaRouter{replicas: []*Replica{r1, r2}}
+
+	read := &stroppy.DriverTransaction{Queries: []*stroppy.DriverQuery{{Name: "q", Request: "SELECT 1"}}}
+	write := &stroppy.DriverTransaction{Queries: []*stroppy.DriverQuery{{Name: "q", Request: "UPDATE t SET v = 1"}}}
+
+	require.Same(t, r2, router.Route(read, TxMode{}))
+	require.Same(t, r1, router.Route(read, TxMode{}))
+	require.Nil(t, router.Route(write, TxMode{}))
+	require.NotNil(t, router.Route(write, TxMode{AccessMode: pgx.ReadOnly}))
+	require.Nil(t, router.Route(read, TxMode{AccessMode: pgx.ReadWrite}))
+
+	serializable := &stroppy.DriverTransaction{
+		IsolationLevel: stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE,
+		Queries:        read.GetQueries(),
+	}
+	require.Nil(t, router.Route(serializable, TxMode{AccessMode: pgx.ReadOnly}))
+
+	copyRows := &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "load", Request: "/* stroppy:copy */ COPY t (a, b) FROM STDIN"}},
+	}
+	require.Nil(t, router.Route(copyRows, TxMode{AccessMode: pgx.ReadOnly}))
+
+	router.declaredOnly = true
+	require.Nil(t, router.Route(read, TxMode{}))
+	require.NotNil(t, router.Route(read, TxMode{AccessMode: pgx.ReadOnly}))
+
+	require.Nil(t, (*ReplicaRouter)(nil).Route(read, TxMode{AccessMode: pgx.ReadOnly}))
+}
+
+func TestReplicaRouter_LeastConnections(t *testing.T) {
+	r1, r2, r3 := &Replica{name: "r1"}, &Replica{name: "r2"}, &Replica{name: "r3"}
+	router := &ReplicaRouter{replicas: []*Replica{r1, r2, r3}, balancing: ReplicaBalancingLeastConnections}
+
+	r1.running.Store(2)
+	r3.running.Store(1)
+
+	for range len(router.replicas) {
+		require.Same(t, r2, router.pick())
+	}
+
+	inFlight := func() error {
+		require.Equal(t, int64(1), r2.running.Load(), "the transaction is in flight")
+
+		return r2.run(func() error {
+			require.Same(t, r3, router.pick())
+
+			return nil
+		})
+	}
+
+	require.NoError(t, r2.run(inFlight))
+	require.Zero(t, r2.running.Load())
+	require.Equal(t, uint64(2), r2.transactions.Load())
+}
+
+func TestDriver_RunTransaction_Replicas(t *testing.T) {
+	primary, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer primary.Close()
+
+	replicaMock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer replicaMock.Close()
+
+	drv := newTestDriver(primary)
+	replica := &Replica{poolTarget: newPoolTarget(replicaMock), name: "r1"}
+	drv.replicas = &ReplicaRouter{replicas: []*Replica{replica}}
+
+	ctx := context.Background()
+
+	replicaMock.ExpectExec("SELECT balance").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	require.NoError(t, drv.RunTransaction(ctx, &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "balance", Request: "SELECT balance FROM accounts"}},
+	}))
+
+	primary.ExpectExec("UPDATE accounts").WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	require.NoError(t, drv.RunTransaction(ctx, &stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Name: "payment", Request: "UPDATE accounts SET balance = 0"}},
+	}))
+
+	require.NoError(t, primary.ExpectationsWereMet())
+	require.NoError(t, replicaMock.ExpectationsWereMet())
+	require.Equal(t, uint64(1), replica.transactions.Load())
+}
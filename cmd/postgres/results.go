@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// read_results switches sequential mode from Exec to Query with all rows decoded.
+// expected_rows maps query name to rows count it must return or affect,
+// rows_mismatch selects whether mismatch fails the transaction or is only counted.
+const (
+	readResultsKey    = "read_results"
+	expectedRowsKey   = "expected_rows"
+	rowsMismatchKey   = "rows_mismatch"
+	rowsMismatchError = "error"
+	rowsMismatchCount = "count"
+)
+
+var ErrUnexpectedRows = errors.New("unexpected rows count")
+
+// ResultValidator compares rows returned or affected by a query with the expectation set by query name.
+type ResultValidator struct {
+	expected map[string]int64
+	// failOnMismatch makes mismatches errors, otherwise they are counted as anomalies.
+	failOnMismatch bool
+
+	mu        sync.Mutex
+	anomalies map[string]uint64
+}
+
+func parseReadResults(cfgMap map[string]any) (bool, error) {
+	return parseBool(cfgMap, readResultsKey)
+}
+
+func parseResultValidator(cfgMap map[string]any) (*ResultValidator, error) {
+	validator := &ResultValidator{
+		expected:       make(map[string]int64),
+		failOnMismatch: true,
+		anomalies:      make(map[string]uint64),
+	}
+
+	if rawAny, exists := cfgMap[expectedRowsKey]; exists {
+		expected, err := parseExpectedRows(rawAny)
+		if err != nil {
+			return nil, err
+		}
+
+		validator.expected = expected
+	}
+
+	if rawAny, exists := cfgMap[rowsMismatchKey]; exists {
+		rawStr, _ := config.String(rawAny)
+
+		switch rawStr {
+		case rowsMismatchError:
+			validator.failOnMismatch = true
+		case rowsMismatchCount:
+			validator.failOnMismatch = false
+		default:
+			return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+				rawAny, rowsMismatchKey,
+				[]string{rowsMismatchError, rowsMismatchCount},
+				pool.ErrUnsupportedParam,
+			)
+		}
+	}
+
+	return validator, nil
+}
+
+// parseExpectedRows parses query name to rows count map.
+func parseExpectedRows(rawAny any) (map[string]int64, error) {
+	values, err := parseNamedValues(expectedRowsKey, rawAny)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]int64, len(values))
+
+	for name, countStr := range values {
+		count, err := strconv.ParseInt(countStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`"%s" of "%s": %w`, name, expectedRowsKey, err)
+		}
+
+		expected[name] = count
+	}
+
+	return expected, nil
+}
+
+// parseNamedValues accepts either a struct or a "name=value,name=value" string.
+func parseNamedValues(key string, rawAny any) (map[string]string, error) {
+	values := make(map[string]string)
+
+	switch raw := rawAny.(type) {
+	case map[string]any:
+		for name, valueAny := range raw {
+			values[name] = fmt.Sprint(valueAny)
+		}
+	case string:
+		for _, pair := range strings.Split(raw, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf(`"%s" of "%s" must be name=value: %w`,
+					pair, key, pool.ErrUnsupportedParam)
+			}
+
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	default:
+		return nil, fmt.Errorf(`"%s" must be a struct or a string, got %v: %w`,
+			key, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	return values, nil
+}
+
+// Check validates rows count returned or affected by the query.
+func (v *ResultValidator) Check(query *stroppy.DriverQuery, rows int64) error {
+	if v == nil {
+		return nil
+	}
+
+	expected, ok := v.expected[query.GetName()]
+	if !ok || expected == rows {
+		return nil
+	}
+
+	if v.failOnMismatch {
+		return fmt.Errorf("expected %d rows, got %d: %w", expected, rows, ErrUnexpectedRows)
+	}
+
+	v.mu.Lock()
+	v.anomalies[query.GetName()]++
+	v.mu.Unlock()
+
+	return nil
+}
+
+// Fails reports whether a rows mismatch of some query of the transaction fails it.
+func (v *ResultValidator) Fails(transaction *stroppy.DriverTransaction) bool {
+	if v == nil || !v.failOnMismatch {
+		return false
+	}
+
+	for _, query := range transaction.GetQueries() {
+		if _, ok := v.expected[query.GetName()]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *ResultValidator) LogStats(logger *zap.Logger) {
+	if v == nil {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, name := range slices.Sorted(maps.Keys(v.anomalies)) {
+		logger.Warn("unexpected rows count anomalies",
+			zap.String("query", name),
+			zap.Int64("expected", v.expected[name]),
+			zap.Uint64("count", v.anomalies[name]),
+		)
+	}
+}
+
+// queryAndDrain runs the query with Query instead of Exec and decodes every returned row,
+// so the cost of reading results is part of the measured transaction.
+// It returns the number of read rows, or affected rows for statements returning nothing.
+func queryAndDrain(
+	ctx context.Context,
+	executor Executor,
+	sql string,
+	arguments ...any,
+) (int64, error) {
+	rows, err := executor.Query(ctx, sql, arguments...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	read := int64(0)
+
+	for rows.Next() {
+		if _, err = rows.Values(); err != nil {
+			return 0, err
+		}
+
+		read++
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if read == 0 {
+		return rows.CommandTag().RowsAffected(), nil
+	}
+
+	return read, nil
+}
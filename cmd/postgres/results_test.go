@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseResultValidator(t *testing.T) {
+	validator, err := parseResultValidator(map[string]any{})
+	require.NoError(t, err)
+	require.Empty(t, validator.expected)
+	require.True(t, validator.failOnMismatch)
+
+	validator, err = parseResultValidator(map[string]any{
+		expectedRowsKey: "select_one=1, update_none = 0,",
+		rowsMismatchKey: rowsMismatchCount,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"select_one": 1, "update_none": 0}, validator.expected)
+	require.False(t, validator.failOnMismatch)
+
+	validator, err = parseResultValidator(map[string]any{
+		expectedRowsKey: map[string]any{"select_one": int32(1)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"select_one": 1}, validator.expected)
+
+	_, err = parseResultValidator(map[string]any{expectedRowsKey: "select_one"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseResultValidator(map[string]any{expectedRowsKey: "select_one=x"})
+	require.Error(t, err)
+
+	_, err = parseResultValidator(map[string]any{rowsMismatchKey: "ignore"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
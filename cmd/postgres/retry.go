@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+const (
+	retryMaxAttemptsKey = "retry_max_attempts"
+	retryBaseDelayKey   = "retry_base_delay"
+	retryMaxDelayKey    = "retry_max_delay"
+	retrySQLStatesKey   = "retry_sqlstates"
+)
+
+const (
+	defaultRetryBaseDelay = 5 * time.Millisecond
+	defaultRetryMaxDelay  = time.Second
+)
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+var ErrInvalidRetryPolicy = errors.New("invalid retry policy")
+
+// RetryPolicy re-runs a whole DriverTransaction when it fails with one of the retryable SQLSTATEs.
+// Zero value runs every transaction exactly once.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	SQLStates   map[string]struct{}
+	// RetryableErr if set marks other errors as retryable.
+	RetryableErr func(err error) bool
+
+	stats RetryStats
+}
+
+// RetryStats counts transaction attempts made under a RetryPolicy.
+type RetryStats struct {
+	Transactions atomic.Uint64
+	Attempts     atomic.Uint64
+	Retries      atomic.Uint64
+	Exhausted    atomic.Uint64
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 1,
+		BaseDelay:   defaultRetryBaseDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		SQLStates: map[string]struct{}{
+			sqlStateSerializationFailure: {},
+			sqlStateDeadlockDetected:     {},
+		},
+	}
+}
+
+func parseRetryPolicy(cfgMap map[string]any) (*RetryPolicy, error) {
+	policy := NewRetryPolicy()
+
+	if rawAny, exists := cfgMap[retryMaxAttemptsKey]; exists {
+		maxAttempts, ok := config.Int(rawAny)
+		if !ok || maxAttempts < 1 {
+			return nil, fmt.Errorf(`"%s" must be a positive integer, got %v: %w`,
+				retryMaxAttemptsKey, rawAny, ErrInvalidRetryPolicy)
+		}
+
+		policy.MaxAttempts = int(maxAttempts)
+	}
+
+	for key, target := range map[string]*time.Duration{
+		retryBaseDelayKey: &policy.BaseDelay,
+		retryMaxDelayKey:  &policy.MaxDelay,
+	} {
+		rawAny, exists := cfgMap[key]
+		if !exists {
+			continue
+		}
+
+		d, ok := config.Duration(rawAny)
+		if !ok {
+			return nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`, key, rawAny, ErrInvalidRetryPolicy)
+		}
+
+		*target = d
+	}
+
+	if policy.BaseDelay > policy.MaxDelay {
+		return nil, fmt.Errorf(`"%s" greater than "%s": %w`,
+			retryBaseDelayKey, retryMaxDelayKey, ErrInvalidRetryPolicy)
+	}
+
+	if rawAny, exists := cfgMap[retrySQLStatesKey]; exists {
+		rawStr, ok := config.String(rawAny)
+		if !ok {
+			return nil, fmt.Errorf(`"%s" must be a comma separated string, got %v: %w`,
+				retrySQLStatesKey, rawAny, ErrInvalidRetryPolicy)
+		}
+
+		policy.SQLStates = make(map[string]struct{})
+
+		for _, code := range strings.Split(rawStr, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				policy.SQLStates[strings.ToUpper(code)] = struct{}{}
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Retryable reports whether err carries one of the policy SQLSTATEs or is accepted by RetryableErr.
+func (p *RetryPolicy) Retryable(err error) bool {
+	if p.RetryableErr != nil && p.RetryableErr(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	_, ok := p.SQLStates[pgErr.Code]
+
+	return ok
+}
+
+// Do calls run until it succeeds, fails with a non-retryable error or attempts are exhausted.
+func (p *RetryPolicy) Do(ctx context.Context, logger *zap.Logger, run func(ctx context.Context) error) error {
+	p.stats.Transactions.Add(1)
+
+	for attempt := 1; ; attempt++ {
+		p.stats.Attempts.Add(1)
+
+		err := run(ctx)
+		if err == nil || !p.Retryable(err) {
+			return err
+		}
+
+		if attempt >= p.MaxAttempts {
+			if p.MaxAttempts <= 1 {
+				return err
+			}
+
+			p.stats.Exhausted.Add(1)
+
+			return fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
+		}
+
+		p.stats.Retries.Add(1)
+
+		delay := p.backoff(attempt)
+		logger.Debug("retry transaction",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns exponential delay for the given attempt with "equal jitter" applied.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		delay = p.BaseDelay << shift
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2 //nolint: mnd // equal jitter
+
+	return half + rand.N(delay-half+1) //nolint: gosec // jitter does not need crypto rand
+}
+
+func (p *RetryPolicy) LogStats(logger *zap.Logger) {
+	logger.Info("transaction retry stats",
+		zap.Int("max_attempts", p.MaxAttempts),
+		zap.Uint64("transactions", p.stats.Transactions.Load()),
+		zap.Uint64("attempts", p.stats.Attempts.Load()),
+		zap.Uint64("retries", p.stats.Retries.Load()),
+		zap.Uint64("exhausted", p.stats.Exhausted.Load()),
+	)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		policy, err := parseRetryPolicy(map[string]any{})
+		require.NoError(t, err)
+		require.Equal(t, 1, policy.MaxAttempts)
+		require.Contains(t, policy.SQLStates, "40001")
+		require.Contains(t, policy.SQLStates, "40P01")
+	})
+
+	t.Run("allConfigured", func(t *testing.T) {
+		policy, err := parseRetryPolicy(map[string]any{
+			"retry_max_attempts": int32(5),
+			"retry_base_delay":   "1ms",
+			"retry_max_delay":    "100ms",
+			"retry_sqlstates":    "40001, 55p03",
+		})
+		require.NoError(t, err)
+		require.Equal(t, 5, policy.MaxAttempts)
+		require.Equal(t, time.Millisecond, policy.BaseDelay)
+		require.Equal(t, 100*time.Millisecond, policy.MaxDelay)
+		require.Len(t, policy.SQLStates, 2)
+		require.Contains(t, policy.SQLStates, "55P03")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseRetryPolicy(map[string]any{"retry_max_attempts": int32(0)})
+		require.ErrorIs(t, err, ErrInvalidRetryPolicy)
+
+		_, err = parseRetryPolicy(map[string]any{"retry_base_delay": "2s", "retry_max_delay": "1s"})
+		require.ErrorIs(t, err, ErrInvalidRetryPolicy)
+	})
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := NewRetryPolicy()
+	policy.MaxAttempts = 2
+	policy.BaseDelay = 0
+	policy.MaxDelay = 0
+
+	calls := 0
+	err := policy.Do(context.Background(), zap.NewNop(), func(_ context.Context) error {
+		calls++
+
+		return &pgconn.PgError{Code: "40001"}
+	})
+	require.Error(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, uint64(1), policy.stats.Exhausted.Load())
+
+	calls = 0
+	errNotRetryable := errors.New("boom")
+	err = policy.Do(context.Background(), zap.NewNop(), func(_ context.Context) error {
+		calls++
+
+		return errNotRetryable
+	})
+	require.ErrorIs(t, err, errNotRetryable)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := NewRetryPolicy()
+	policy.BaseDelay = 10 * time.Millisecond
+	policy.MaxDelay = 40 * time.Millisecond
+
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := policy.backoff(attempt)
+		require.LessOrEqual(t, delay, policy.MaxDelay)
+		require.GreaterOrEqual(t, delay, policy.BaseDelay/2)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+	"github.com/stroppy-io/stroppy-postgres/internal/queries"
+)
+
+// dbSpecificSchema lists every db_specific key of the plugin, Initialize rejects anything else.
+var dbSpecificSchema = config.Merge(pool.Schema, queries.Schema, config.Schema{
+	retryMaxAttemptsKey:        config.KindInt,
+	retryBaseDelayKey:          config.KindDuration,
+	retryMaxDelayKey:           config.KindDuration,
+	retrySQLStatesKey:          config.KindString,
+	transactionExecModeKey:     config.KindString,
+	connectionModeKey:          config.KindString,
+	preparedStatementsKey:      config.KindBool,
+	readResultsKey:             config.KindBool,
+	expectedRowsKey:            config.KindStructOrString,
+	rowsMismatchKey:            config.KindString,
+	latencyReportPathKey:       config.KindString,
+	latencyLogIntervalKey:      config.KindDuration,
+	errorPolicyKey:             config.KindStructOrString,
+	metricsAddressKey:          config.KindString,
+	metricsPathKey:             config.KindString,
+	pgStatReportKey:            config.KindString,
+	pgStatTopStatementsKey:     config.KindInt,
+	waitEventSampleIntervalKey: config.KindDuration,
+	waitEventReportKey:         config.KindString,
+	localSettingsKey:           config.KindStructOrString,
+	transactionModesKey:        config.KindStructOrString,
+	replicaURLsKey:             config.KindStructOrString,
+	replicaBalancingKey:        config.KindString,
+	replicaReadsKey:            config.KindString,
+	replicationLagIntervalKey:  config.KindDuration,
+	replicationLagMethodKey:    config.KindString,
+	replicationLagTableKey:     config.KindString,
+	replicationLagReportKey:    config.KindString,
+})
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// transaction_modes are transaction options keyed by transaction label:
+// struct of "read only, deferrable" strings or of structs with access_mode, deferrable_mode and begin_query,
+// or "label:read only, deferrable;label:read write" string.
+// Transactions with a mode always run in an explicit transaction.
+const transactionModesKey = "transaction_modes"
+
+const (
+	accessModeKey     = "access_mode"
+	deferrableModeKey = "deferrable_mode"
+	beginQueryKey     = "begin_query"
+)
+
+var (
+	supportedAccessModes     = []pgx.TxAccessMode{pgx.ReadWrite, pgx.ReadOnly}
+	supportedDeferrableModes = []pgx.TxDeferrableMode{pgx.Deferrable, pgx.NotDeferrable}
+)
+
+// TxMode holds the transaction options beside the isolation level.
+type TxMode struct {
+	AccessMode     pgx.TxAccessMode
+	DeferrableMode pgx.TxDeferrableMode
+	// BeginQuery replaces the BEGIN statement built from the options.
+	BeginQuery string
+}
+
+// ReadOnly reports whether the transaction is declared READ ONLY.
+func (m TxMode) ReadOnly() bool {
+	return m.AccessMode == pgx.ReadOnly
+}
+
+func (m TxMode) isZero() bool {
+	return m == TxMode{}
+}
+
+// TxModes are transaction options keyed by transaction label.
+type TxModes map[string]TxMode
+
+// For returns the options of the transaction, zero TxMode when none are configured.
+func (m TxModes) For(transaction *stroppy.DriverTransaction) TxMode {
+	if len(m) == 0 {
+		return TxMode{}
+	}
+
+	return m[transactionLabel(transaction)]
+}
+
+func parseTxModes(cfgMap map[string]any) (TxModes, error) {
+	rawAny, exists := cfgMap[transactionModesKey]
+	if !exists {
+		return nil, nil
+	}
+
+	modes := make(TxModes)
+
+	switch raw := rawAny.(type) {
+	case map[string]any:
+		for label, modeAny := range raw {
+			mode, err := parseTxMode(label, modeAny)
+			if err != nil {
+				return nil, err
+			}
+
+			modes[label] = mode
+		}
+	case string:
+		for _, entry := range strings.Split(raw, ";") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+
+			label, words, ok := strings.Cut(entry, ":")
+			if !ok {
+				return nil, fmt.Errorf(`"%s" of "%s" must be label:mode: %w`,
+					entry, transactionModesKey, pool.ErrUnsupportedParam)
+			}
+
+			mode, err := parseTxModeWords(words)
+			if err != nil {
+				return nil, err
+			}
+
+			modes[strings.TrimSpace(label)] = mode
+		}
+	default:
+		return nil, fmt.Errorf(`"%s" must be a struct or a string, got %v: %w`,
+			transactionModesKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	return modes, nil
+}
+
+func parseTxMode(label string, modeAny any) (TxMode, error) {
+	switch raw := modeAny.(type) {
+	case string:
+		return parseTxModeWords(raw)
+	case map[string]any:
+		var mode TxMode
+
+		for key, valueAny := range raw {
+			value := fmt.Sprint(valueAny)
+
+			switch key {
+			case accessModeKey:
+				accessMode, err := parseAccessMode(value)
+				if err != nil {
+					return TxMode{}, err
+				}
+
+				mode.AccessMode = accessMode
+			case deferrableModeKey:
+				deferrableMode, err := parseDeferrableMode(value)
+				if err != nil {
+					return TxMode{}, err
+				}
+
+				mode.DeferrableMode = deferrableMode
+			case beginQueryKey:
+				mode.BeginQuery = value
+			default:
+				return TxMode{}, fmt.Errorf(`"%s" invalid for "%s.%s" key; supported values are %v: %w`,
+					key, transactionModesKey, label,
+					[]string{accessModeKey, deferrableModeKey, beginQueryKey}, pool.ErrUnsupportedParam)
+			}
+		}
+
+		return mode, nil
+	default:
+		return TxMode{}, fmt.Errorf(`"%s.%s" must be a struct or a string, got %v: %w`,
+			transactionModesKey, label, modeAny, pool.ErrUnsupportedParam)
+	}
+}
+
+// parseTxModeWords parses comma separated modes like "read only, deferrable".
+func parseTxModeWords(words string) (TxMode, error) {
+	var mode TxMode
+
+	for _, word := range strings.Split(words, ",") {
+		word = normalizeTxModeWord(word)
+		if word == "" {
+			continue
+		}
+
+		if accessMode, err := parseAccessMode(word); err == nil {
+			mode.AccessMode = accessMode
+
+			continue
+		}
+
+		deferrableMode, err := parseDeferrableMode(word)
+		if err != nil {
+			return TxMode{}, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v %v: %w`,
+				word, transactionModesKey, supportedAccessModes, supportedDeferrableModes, pool.ErrUnsupportedParam)
+		}
+
+		mode.DeferrableMode = deferrableMode
+	}
+
+	return mode, nil
+}
+
+// normalizeTxModeWord accepts both "read only" and "read_only" spelling.
+func normalizeTxModeWord(word string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(word, "_", " "))), " ")
+}
+
+func parseAccessMode(value string) (pgx.TxAccessMode, error) {
+	value = normalizeTxModeWord(value)
+
+	for _, accessMode := range supportedAccessModes {
+		if value == string(accessMode) {
+			return accessMode, nil
+		}
+	}
+
+	return "", fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+		value, accessModeKey, supportedAccessModes, pool.ErrUnsupportedParam)
+}
+
+func parseDeferrableMode(value string) (pgx.TxDeferrableMode, error) {
+	value = normalizeTxModeWord(value)
+
+	for _, deferrableMode := range supportedDeferrableModes {
+		if value == string(deferrableMode) {
+			return deferrableMode, nil
+		}
+	}
+
+	return "", fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+		value, deferrableModeKey, supportedDeferrableModes, pool.ErrUnsupportedParam)
+}
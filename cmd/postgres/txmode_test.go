@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	trmpgx "github.com/avito-tech/go-transaction-manager/drivers/pgxv5/v2"
+	"github.com/avito-tech/go-transaction-manager/trm/v2/manager"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseTxModes(t *testing.T) {
+	modes, err := parseTxModes(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, modes)
+
+	modes, err = parseTxModes(map[string]any{
+		transactionModesKey: "report:READ_ONLY, deferrable; payment:read write",
+	})
+	require.NoError(t, err)
+	require.Equal(t, TxModes{
+		"report":  {AccessMode: pgx.ReadOnly, DeferrableMode: pgx.Deferrable},
+		"payment": {AccessMode: pgx.ReadWrite},
+	}, modes)
+
+	modes, err = parseTxModes(map[string]any{
+		transactionModesKey: map[string]any{
+			"report": "read only",
+			"audit": map[string]any{
+				accessModeKey:     "read_write",
+				deferrableModeKey: "not deferrable",
+				beginQueryKey:     "BEGIN; SET LOCAL lock_timeout = '1s'",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, TxModes{
+		"report": {AccessMode: pgx.ReadOnly},
+		"audit": {
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.NotDeferrable,
+			BeginQuery:     "BEGIN; SET LOCAL lock_timeout = '1s'",
+		},
+	}, modes)
+	require.True(t, modes["report"].ReadOnly())
+
+	for _, raw := range []any{
+		"read only",
+		"report:write only",
+		map[string]any{"report": map[string]any{"isolation": "serializable"}},
+		map[string]any{"report": map[string]any{accessModeKey: "deferrable"}},
+		int32(1),
+	} {
+		_, err = parseTxModes(map[string]any{transactionModesKey: raw})
+		require.ErrorIs(t, err, pool.ErrUnsupportedParam, raw)
+	}
+}
+
+func TestNewStroppyIsolationSettings(t *testing.T) {
+	beginFor := func(transaction *stroppy.DriverTransaction, mode TxMode) string {
+		txSettings, err := NewStroppyIsolationSettings(transaction, mode)
+		require.NoError(t, err)
+
+		return beginSQL(txSettings.TxOpts())
+	}
+
+	transaction := &stroppy.DriverTransaction{
+		IsolationLevel: stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE,
+	}
+
+	require.Equal(t,
+		"begin isolation level serializable read only deferrable",
+		beginFor(transaction, TxMode{AccessMode: pgx.ReadOnly, DeferrableMode: pgx.Deferrable}))
+	require.Equal(t, "begin read only", beginFor(&stroppy.DriverTransaction{}, TxMode{AccessMode: pgx.ReadOnly}))
+	require.Equal(t, "BEGIN", beginFor(transaction, TxMode{BeginQuery: "BEGIN"}))
+
+	_, err := NewStroppyIsolationSettings(&stroppy.DriverTransaction{IsolationLevel: 42}, TxMode{})
+	require.ErrorIs(t, err, ErrUnsupportedIsolationLevel)
+}
+
+func TestDriver_RunTransaction_TxModes(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	drv := newTestDriver(mock)
+	drv.txManager = manager.Must(trmpgx.NewDefaultFactory(mock))
+	drv.txExecutor = NewTxExecutor(mock)
+	drv.txModes = TxModes{"report": {AccessMode: pgx.ReadOnly, DeferrableMode: pgx.Deferrable}}
+
+	ctx := context.Background()
+	transaction := &stroppy.DriverTransaction{
+		IsolationLevel: stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_SERIALIZABLE,
+		Queries: []*stroppy.DriverQuery{
+			{Name: "report", Request: "SELECT sum(v) FROM t"},
+		},
+	}
+
+	mock.ExpectBeginTx(pgx.TxOptions{
+		IsoLevel:       pgx.Serializable,
+		AccessMode:     pgx.ReadOnly,
+		DeferrableMode: pgx.Deferrable,
+	})
+	mock.ExpectExec("SELECT sum").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectCommit()
+	require.NoError(t, drv.RunTransaction(ctx, transaction))
+
+	// a mode alone makes the transaction explicit
+	transaction.IsolationLevel = stroppy.TxIsolationLevel_TX_ISOLATION_LEVEL_UNSPECIFIED
+	drv.execMode = TransactionExecModeBatch
+
+	batch := mock.ExpectBatch()
+	batch.ExpectExec("begin read only deferrable").WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+	batch.ExpectExec("SELECT sum").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	batch.ExpectExec("COMMIT").WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+	require.NoError(t, drv.runTransactionBatch(ctx, transaction, mock.AsConn()))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+// wait_event_sample_interval enables sampling of pg_stat_activity with the given interval,
+// wait_event_report is a file the wait-event profile is written to at Teardown.
+const (
+	waitEventSampleIntervalKey = "wait_event_sample_interval"
+	waitEventReportKey         = "wait_event_report"
+)
+
+const waitEventReportFileMode = 0o644
+
+type waitEventsConfig struct {
+	interval   time.Duration
+	reportPath string
+}
+
+// parseWaitEvents returns nil when "wait_event_sample_interval" is not set.
+func parseWaitEvents(cfgMap map[string]any) (*waitEventsConfig, error) {
+	rawAny, exists := cfgMap[waitEventSampleIntervalKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // sampling is disabled
+	}
+
+	interval, ok := config.Duration(rawAny)
+	if !ok {
+		return nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`,
+			waitEventSampleIntervalKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf(`"%s" must be positive, got %v: %w`,
+			waitEventSampleIntervalKey, rawAny, pool.ErrUnsupportedParam)
+	}
+
+	cfg := &waitEventsConfig{interval: interval}
+
+	if rawAny, exists := cfgMap[waitEventReportKey]; exists {
+		if cfg.reportPath, ok = config.String(rawAny); !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+				waitEventReportKey, rawAny, pool.ErrUnsupportedParam)
+		}
+	}
+
+	return cfg, nil
+}
+
+// registerWaitQuery lets the wait-event sampler name backends running the request.
+func (d *Driver) registerWaitQuery(request, name string) {
+	if d.waitSampler != nil {
+		d.waitSampler.Register(request, name)
+	}
+}
+
+// stopWaitSampler logs the wait-event profile and writes it to the report file if set.
+func (d *Driver) stopWaitSampler() error {
+	if d.waitSampler == nil {
+		return nil
+	}
+
+	profile := d.waitSampler.Stop()
+	d.logger.Info("wait event profile", zap.Any("profile", profile))
+
+	if d.waitEvents.reportPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.waitEvents.reportPath, data, waitEventReportFileMode)
+}
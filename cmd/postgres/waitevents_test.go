@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/pool"
+)
+
+func TestParseWaitEvents(t *testing.T) {
+	cfg, err := parseWaitEvents(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	cfg, err = parseWaitEvents(map[string]any{
+		waitEventSampleIntervalKey: "100ms",
+		waitEventReportKey:         "waits.json",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &waitEventsConfig{interval: 100 * time.Millisecond, reportPath: "waits.json"}, cfg)
+
+	_, err = parseWaitEvents(map[string]any{waitEventSampleIntervalKey: "0s"})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+
+	_, err = parseWaitEvents(map[string]any{waitEventSampleIntervalKey: "1s", waitEventReportKey: true})
+	require.ErrorIs(t, err, pool.ErrUnsupportedParam)
+}
@@ -0,0 +1,103 @@
+// Package config reads db_specific values with type coercion and validates them against a schema.
+//
+// db_specific arrives as protobuf values, so the same YAML number may be int32, int64 or double
+// and anything may be quoted as a string. Accessors below accept every lossless representation.
+package config
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Int returns value as an integer: any integer type, integral float or numeric string.
+func Int(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+
+		return int64(v), true
+	case float32:
+		return floatToInt(float64(v))
+	case float64:
+		return floatToInt(v)
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Int32 is Int limited to the int32 range.
+func Int32(value any) (int32, bool) {
+	i, ok := Int(value)
+	if !ok || i < math.MinInt32 || i > math.MaxInt32 {
+		return 0, false
+	}
+
+	return int32(i), true
+}
+
+func floatToInt(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(f), true
+}
+
+// Bool returns value as a bool: bool or a string accepted by strconv.ParseBool.
+func Bool(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+
+		return b, err == nil
+	default:
+		return false, false
+	}
+}
+
+// String returns value as a string, numbers and bools are not turned into strings.
+func String(value any) (string, bool) {
+	v, ok := value.(string)
+
+	return v, ok
+}
+
+// Duration returns value as a duration: string accepted by time.ParseDuration or time.Duration.
+func Duration(value any) (time.Duration, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+
+		return d, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInt(t *testing.T) {
+	for _, value := range []any{int32(7), int64(7), uint32(7), float32(7), 7.0, "7", " 7 "} {
+		i, ok := Int(value)
+		require.True(t, ok, "%v (%T)", value, value)
+		require.Equal(t, int64(7), i)
+	}
+
+	for _, value := range []any{7.5, "7s", "", true, nil, uint64(1 << 63)} {
+		_, ok := Int(value)
+		require.False(t, ok, "%v (%T)", value, value)
+	}
+
+	_, ok := Int32(int64(1) << 40)
+	require.False(t, ok)
+}
+
+func TestBool(t *testing.T) {
+	for value, expected := range map[any]bool{true: true, "true": true, "0": false, "FALSE": false} {
+		b, ok := Bool(value)
+		require.True(t, ok, value)
+		require.Equal(t, expected, b)
+	}
+
+	_, ok := Bool(int32(1))
+	require.False(t, ok)
+}
+
+func TestDuration(t *testing.T) {
+	d, ok := Duration("150ms")
+	require.True(t, ok)
+	require.Equal(t, 150*time.Millisecond, d)
+
+	for _, value := range []any{"150", int32(150), nil} {
+		_, ok = Duration(value)
+		require.False(t, ok, value)
+	}
+}
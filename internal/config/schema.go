@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var (
+	ErrUnknownKey  = errors.New("unknown key")
+	ErrInvalidType = errors.New("invalid value type")
+)
+
+// Kind is the expected type of a db_specific value.
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindBool
+	KindInt
+	KindDuration
+	// KindStructOrString is a nested struct or its string shorthand, parsed by the key owner.
+	KindStructOrString
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "a string"
+	case KindBool:
+		return "a bool"
+	case KindInt:
+		return "an integer"
+	case KindDuration:
+		return "a duration string"
+	case KindStructOrString:
+		return "a struct or a string"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+func (k Kind) accepts(value any) bool {
+	var ok bool
+
+	switch k {
+	case KindString:
+		_, ok = String(value)
+	case KindBool:
+		_, ok = Bool(value)
+	case KindInt:
+		_, ok = Int(value)
+	case KindDuration:
+		_, ok = Duration(value)
+	case KindStructOrString:
+		switch value.(type) {
+		case map[string]any, string:
+			ok = true
+		}
+	}
+
+	return ok
+}
+
+// Schema maps every supported db_specific key to the kind of its value.
+type Schema map[string]Kind
+
+// Merge joins schemas of the packages reading the same db_specific.
+func Merge(schemas ...Schema) Schema {
+	merged := make(Schema)
+
+	for _, schema := range schemas {
+		maps.Copy(merged, schema)
+	}
+
+	return merged
+}
+
+// Validate reports all unknown keys and values of a wrong type at once.
+// Value ranges and enums are left to the key owners.
+func (s Schema) Validate(cfgMap map[string]any) error {
+	var errs []error
+
+	for _, key := range slices.Sorted(maps.Keys(cfgMap)) {
+		value := cfgMap[key]
+
+		kind, known := s[key]
+		if !known {
+			if suggestion := s.closest(key); suggestion != "" {
+				errs = append(errs, fmt.Errorf(`"%s", did you mean "%s": %w`, key, suggestion, ErrUnknownKey))
+			} else {
+				errs = append(errs, fmt.Errorf(`"%s": %w`, key, ErrUnknownKey))
+			}
+
+			continue
+		}
+
+		if !kind.accepts(value) {
+			errs = append(errs, fmt.Errorf(`"%s" must be %s, got %v (%T): %w`, key, kind, value, value, ErrInvalidType))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// closest returns the known key within a few typos of key, if any.
+func (s Schema) closest(key string) string {
+	const maxDistance = 3
+
+	best, bestDistance := "", maxDistance+1
+
+	for _, known := range slices.Sorted(maps.Keys(s)) {
+		if distance := levenshtein(key, known); distance < bestDistance {
+			best, bestDistance = known, distance
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
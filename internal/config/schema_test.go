@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	schema := Merge(
+		Schema{"max_conns": KindInt, "trace_log_level": KindString},
+		Schema{"read_results": KindBool, "retry_max_delay": KindDuration, "error_policy": KindStructOrString},
+	)
+
+	require.NoError(t, schema.Validate(map[string]any{
+		"max_conns":       "10",
+		"trace_log_level": "debug",
+		"read_results":    "true",
+		"retry_max_delay": "1s",
+		"error_policy":    map[string]any{"unique_violation": "count"},
+	}))
+
+	err := schema.Validate(map[string]any{
+		"max_con":         int32(10),
+		"something_else":  int32(1),
+		"read_results":    int32(1),
+		"retry_max_delay": int32(1),
+		"error_policy":    int32(1),
+	})
+	require.ErrorIs(t, err, ErrUnknownKey)
+	require.ErrorIs(t, err, ErrInvalidType)
+	require.ErrorContains(t, err, `"max_con", did you mean "max_conns"`)
+	require.ErrorContains(t, err, `"something_else": unknown key`)
+	require.ErrorContains(t, err, `"read_results" must be a bool, got 1 (int32)`)
+	require.ErrorContains(t, err, `"retry_max_delay" must be a duration string`)
+	require.ErrorContains(t, err, `"error_policy" must be a struct or a string`)
+}
@@ -0,0 +1,317 @@
+package pgstat
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// LagMethod is how replication lag is measured.
+type LagMethod string
+
+const (
+	// LagMethodHeartbeat writes a heartbeat row on the primary and reads it on every replica.
+	LagMethodHeartbeat LagMethod = "heartbeat"
+	// LagMethodStatReplication reads replay_lag of pg_stat_replication on the primary.
+	LagMethodStatReplication LagMethod = "pg_stat_replication"
+)
+
+const statReplicationLagSQL = `SELECT coalesce(nullif(application_name, ''), host(client_addr), pid::text),
+coalesce(extract(epoch FROM replay_lag), 0)::float8
+FROM pg_stat_replication`
+
+// Executor is satisfied by pgxpool.Pool and pgx.Conn.
+type Executor interface {
+	Querier
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// LagReplica is a replica the heartbeat is read on.
+type LagReplica struct {
+	Name    string
+	Querier Querier
+}
+
+// LagPoint is the lag of a replica at the sample time.
+type LagPoint struct {
+	Time time.Time     `json:"time"`
+	Lag  time.Duration `json:"lag_ns"`
+}
+
+// LagSeries is the lag of a replica over the run.
+type LagSeries struct {
+	Max    time.Duration `json:"max_ns"`
+	Mean   time.Duration `json:"mean_ns"`
+	Points []LagPoint    `json:"points"`
+}
+
+// LagReport is the replication lag time series by replica name.
+type LagReport struct {
+	Method   LagMethod             `json:"method"`
+	Interval time.Duration         `json:"interval_ns"`
+	Replicas map[string]*LagSeries `json:"replicas"`
+}
+
+// heartbeat is a sequence number written on the primary.
+type heartbeat struct {
+	seq     int64
+	written time.Time
+}
+
+// LagMonitor samples replication lag every interval.
+//
+// With the heartbeat method the lag is the time since the oldest heartbeat the replica has not replayed yet,
+// zero when the replica has the latest one, so the resolution is the sampling interval.
+type LagMonitor struct {
+	primary  Executor
+	replicas []LagReplica
+	method   LagMethod
+	interval time.Duration
+	table    string
+	id       string
+	logger   *zap.Logger
+
+	// seq and pending are touched only by the sampling goroutine.
+	seq     int64
+	pending []heartbeat
+
+	mu     sync.Mutex
+	series map[string]*LagSeries
+	last   map[string]time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLagMonitor creates the monitor, id tells heartbeat rows of concurrent drivers apart.
+func NewLagMonitor(
+	primary Executor,
+	replicas []LagReplica,
+	method LagMethod,
+	interval time.Duration,
+	table, id string,
+	logger *zap.Logger,
+) *LagMonitor {
+	return &LagMonitor{
+		primary:  primary,
+		replicas: replicas,
+		method:   method,
+		interval: interval,
+		table:    pgx.Identifier{table}.Sanitize(),
+		id:       id,
+		logger:   logger,
+		series:   make(map[string]*LagSeries),
+		last:     make(map[string]time.Duration),
+	}
+}
+
+// Start creates the heartbeat table if needed and samples the lag every interval until Stop.
+func (m *LagMonitor) Start(ctx context.Context) error {
+	if m.method == LagMethodHeartbeat {
+		_, err := m.primary.Exec(ctx,
+			"CREATE TABLE IF NOT EXISTS "+m.table+" (id text PRIMARY KEY, seq bigint NOT NULL, written timestamptz NOT NULL)")
+		if err != nil {
+			return err
+		}
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if err := m.sample(context.Background()); err != nil {
+					m.logger.Warn("failed to sample replication lag", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (m *LagMonitor) sample(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	if m.method == LagMethodStatReplication {
+		return m.sampleStatReplication(ctx)
+	}
+
+	return m.sampleHeartbeat(ctx)
+}
+
+func (m *LagMonitor) sampleStatReplication(ctx context.Context) error {
+	rows, err := m.primary.Query(ctx, statReplicationLagSQL)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+
+	for rows.Next() {
+		var (
+			name string
+			lag  float64
+		)
+
+		if err = rows.Scan(&name, &lag); err != nil {
+			return err
+		}
+
+		m.record(name, now, time.Duration(lag*float64(time.Second)))
+	}
+
+	return rows.Err()
+}
+
+func (m *LagMonitor) sampleHeartbeat(ctx context.Context) error {
+	seq := m.seq + 1
+
+	written := time.Now()
+
+	_, err := m.primary.Exec(ctx,
+		"INSERT INTO "+m.table+" (id, seq, written) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (id) DO UPDATE SET seq = excluded.seq, written = excluded.written",
+		m.id, seq, written)
+	if err != nil {
+		return err
+	}
+
+	m.seq = seq
+	m.pending = append(m.pending, heartbeat{seq: seq, written: written})
+
+	var errs []error
+
+	oldest := seq
+
+	for _, replica := range m.replicas {
+		replayed, err := m.replayedSeq(ctx, replica.Querier)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		m.record(replica.Name, time.Now(), m.lagSince(replayed))
+
+		oldest = min(oldest, replayed)
+	}
+
+	// NOTE: heartbeats every replica has replayed are not needed anymore,
+	// failed replicas keep all of them until they answer again.
+	if len(errs) == 0 {
+		m.prune(oldest)
+	}
+
+	return errors.Join(errs...)
+}
+
+// replayedSeq returns the last heartbeat seen by the replica, zero when there is none yet.
+func (m *LagMonitor) replayedSeq(ctx context.Context, querier Querier) (int64, error) {
+	rows, err := querier.Query(ctx, "SELECT seq FROM "+m.table+" WHERE id = $1", m.id)
+	if err != nil {
+		return 0, err
+	}
+
+	seq, err := pgx.CollectOneRow(rows, pgx.RowTo[int64])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+
+	return seq, err
+}
+
+// lagSince returns the time since the first heartbeat after replayed was written.
+func (m *LagMonitor) lagSince(replayed int64) time.Duration {
+	for _, beat := range m.pending {
+		if beat.seq > replayed {
+			return time.Since(beat.written)
+		}
+	}
+
+	return 0
+}
+
+func (m *LagMonitor) prune(replayed int64) {
+	i := 0
+	for i < len(m.pending) && m.pending[i].seq <= replayed {
+		i++
+	}
+
+	m.pending = m.pending[i:]
+}
+
+func (m *LagMonitor) record(name string, at time.Time, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.series[name]
+	if !ok {
+		series = &LagSeries{}
+		m.series[name] = series
+	}
+
+	series.Points = append(series.Points, LagPoint{Time: at, Lag: lag})
+	series.Max = max(series.Max, lag)
+	m.last[name] = lag
+}
+
+// Last returns the latest lag of every replica.
+func (m *LagMonitor) Last() map[string]time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return maps.Clone(m.last)
+}
+
+// Stop stops sampling, removes the heartbeat row and returns the collected series.
+func (m *LagMonitor) Stop(ctx context.Context) *LagReport {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+
+		if m.method == LagMethodHeartbeat {
+			if _, err := m.primary.Exec(ctx, "DELETE FROM "+m.table+" WHERE id = $1", m.id); err != nil {
+				m.logger.Warn("failed to remove heartbeat row", zap.Error(err))
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, series := range m.series {
+		var total time.Duration
+		for _, point := range series.Points {
+			total += point.Lag
+		}
+
+		if len(series.Points) > 0 {
+			series.Mean = total / time.Duration(len(series.Points))
+		}
+	}
+
+	return &LagReport{
+		Method:   m.method,
+		Interval: m.interval,
+		Replicas: m.series,
+	}
+}
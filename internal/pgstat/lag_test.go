@@ -0,0 +1,120 @@
+package pgstat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+)
+
+func TestLagMonitor_Heartbeat(t *testing.T) {
+	primary, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer primary.Close()
+
+	replica, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer replica.Close()
+
+	monitor := NewLagMonitor(primary, []LagReplica{{Name: "r1", Querier: replica}},
+		LagMethodHeartbeat, time.Second, "stroppy_heartbeat", "app", logger.Global())
+
+	insertSQL := `INSERT INTO "stroppy_heartbeat" (id, seq, written) VALUES ($1, $2, $3) ` +
+		`ON CONFLICT (id) DO UPDATE SET seq = excluded.seq, written = excluded.written`
+	selectSQL := `SELECT seq FROM "stroppy_heartbeat" WHERE id = $1`
+
+	// the replica has not replayed the first heartbeat yet
+	primary.ExpectExec(insertSQL).WithArgs("app", int64(1), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	replica.ExpectQuery(selectSQL).WithArgs("app").WillReturnRows(replica.NewRows([]string{"seq"}))
+	require.NoError(t, monitor.sample(context.Background()))
+
+	// the replica is one heartbeat behind
+	primary.ExpectExec(insertSQL).WithArgs("app", int64(2), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	replica.ExpectQuery(selectSQL).WithArgs("app").WillReturnRows(replica.NewRows([]string{"seq"}).AddRow(int64(1)))
+	require.NoError(t, monitor.sample(context.Background()))
+	require.Len(t, monitor.pending, 1)
+
+	// the replica is unavailable, heartbeats are kept
+	primary.ExpectExec(insertSQL).WithArgs("app", int64(3), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	replica.ExpectQuery(selectSQL).WithArgs("app").WillReturnError(errors.New("connection refused"))
+	require.Error(t, monitor.sample(context.Background()))
+	require.Len(t, monitor.pending, 2)
+
+	// the replica caught up
+	primary.ExpectExec(insertSQL).WithArgs("app", int64(4), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	replica.ExpectQuery(selectSQL).WithArgs("app").WillReturnRows(replica.NewRows([]string{"seq"}).AddRow(int64(4)))
+	require.NoError(t, monitor.sample(context.Background()))
+	require.Empty(t, monitor.pending)
+	require.Equal(t, map[string]time.Duration{"r1": 0}, monitor.Last())
+
+	require.NoError(t, primary.ExpectationsWereMet())
+	require.NoError(t, replica.ExpectationsWereMet())
+
+	report := monitor.Stop(context.Background())
+	require.Equal(t, LagMethodHeartbeat, report.Method)
+	require.Len(t, report.Replicas["r1"].Points, 3)
+	require.Positive(t, report.Replicas["r1"].Points[0].Lag)
+	require.Positive(t, report.Replicas["r1"].Points[1].Lag)
+	require.Zero(t, report.Replicas["r1"].Points[2].Lag)
+	require.GreaterOrEqual(t, report.Replicas["r1"].Max, report.Replicas["r1"].Mean)
+}
+
+func TestLagMonitor_StatReplication(t *testing.T) {
+	primary, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer primary.Close()
+
+	monitor := NewLagMonitor(primary, nil, LagMethodStatReplication, time.Second, "unused", "app", logger.Global())
+
+	for _, lags := range [][]float64{{0.5, 0}, {1.5, 0.25}} {
+		primary.ExpectQuery(statReplicationLagSQL).WillReturnRows(
+			primary.NewRows([]string{"application_name", "replay_lag"}).
+				AddRow("standby1", lags[0]).
+				AddRow("10.0.0.2", lags[1]),
+		)
+		require.NoError(t, monitor.sample(context.Background()))
+	}
+
+	require.NoError(t, primary.ExpectationsWereMet())
+
+	report := monitor.Stop(context.Background())
+	require.Equal(t, &LagSeries{
+		Max:  1500 * time.Millisecond,
+		Mean: time.Second,
+		Points: []LagPoint{
+			{Time: report.Replicas["standby1"].Points[0].Time, Lag: 500 * time.Millisecond},
+			{Time: report.Replicas["standby1"].Points[1].Time, Lag: 1500 * time.Millisecond},
+		},
+	}, report.Replicas["standby1"])
+	require.Equal(t, 250*time.Millisecond, report.Replicas["10.0.0.2"].Max)
+}
+
+func TestLagMonitor_StartStop(t *testing.T) {
+	primary, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer primary.Close()
+
+	primary.MatchExpectationsInOrder(false)
+
+	primary.ExpectExec(`CREATE TABLE IF NOT EXISTS "hb" ` +
+		`(id text PRIMARY KEY, seq bigint NOT NULL, written timestamptz NOT NULL)`).
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	primary.ExpectExec(`DELETE FROM "hb" WHERE id = $1`).WithArgs("app").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	monitor := NewLagMonitor(primary, nil, LagMethodHeartbeat, time.Hour, "hb", "app", logger.Global())
+	require.NoError(t, monitor.Start(context.Background()))
+
+	report := monitor.Stop(context.Background())
+	require.Empty(t, report.Replicas)
+	require.NoError(t, primary.ExpectationsWereMet())
+}
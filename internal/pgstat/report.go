@@ -0,0 +1,106 @@
+package pgstat
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+const (
+	statementsView = "pg_stat_statements"
+	queryLabel     = "query"
+)
+
+// totalTimeCounters rank statements, the counter was renamed in PostgreSQL 13.
+var totalTimeCounters = []string{"total_exec_time", "total_time"}
+
+// Report is the difference of two snapshots, zero deltas are omitted.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Views are counter deltas by view name and row key.
+	Views map[string]map[string]map[string]float64 `json:"views"`
+	// TopStatements are pg_stat_statements rows with the highest total execution time delta.
+	TopStatements []Statement `json:"top_statements,omitempty"`
+}
+
+type Statement struct {
+	Query  string             `json:"query"`
+	Deltas map[string]float64 `json:"deltas"`
+}
+
+// Diff computes counters deltas from before to after,
+// rows which appeared after the first snapshot are compared with zero.
+func Diff(before, after *Snapshot, topStatements int) *Report {
+	report := &Report{
+		Started:  before.Time,
+		Finished: after.Time,
+		Views:    make(map[string]map[string]map[string]float64),
+	}
+
+	for name, afterRows := range after.Views {
+		beforeRows := before.Views[name]
+
+		if name == statementsView {
+			report.TopStatements = diffStatements(beforeRows, afterRows, topStatements)
+
+			continue
+		}
+
+		deltas := make(map[string]map[string]float64)
+
+		for key, row := range afterRows {
+			if delta := diffRow(beforeRows[key], row); len(delta) > 0 {
+				deltas[key] = delta
+			}
+		}
+
+		report.Views[name] = deltas
+	}
+
+	return report
+}
+
+func diffRow(before, after Row) map[string]float64 {
+	delta := make(map[string]float64)
+
+	for counter, value := range after.Counters {
+		if d := value - before.Counters[counter]; d != 0 {
+			delta[counter] = d
+		}
+	}
+
+	return delta
+}
+
+func diffStatements(before, after map[string]Row, top int) []Statement {
+	statements := make([]Statement, 0, len(after))
+
+	for key, row := range after {
+		delta := diffRow(before[key], row)
+		if len(delta) == 0 {
+			continue
+		}
+
+		statements = append(statements, Statement{
+			Query:  row.Labels[queryLabel],
+			Deltas: delta,
+		})
+	}
+
+	slices.SortFunc(statements, func(a, b Statement) int {
+		return cmp.Compare(totalTime(b), totalTime(a))
+	})
+
+	return statements[:min(top, len(statements))]
+}
+
+func totalTime(statement Statement) float64 {
+	for _, counter := range totalTimeCounters {
+		if value, ok := statement.Deltas[counter]; ok {
+			return value
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,180 @@
+// Package pgstat snapshots server statistics views and reports their deltas.
+package pgstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// sqlStateUndefinedTable is returned for views missing in the server version or not installed extensions.
+const sqlStateUndefinedTable = "42P01"
+
+// Querier is satisfied by pgxpool.Pool and pgx.Conn.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// view is a statistics view snapshot with rows identified by key columns, missing key columns are empty.
+type view struct {
+	name string
+	sql  string
+	keys []string
+	// optional views are skipped when missing, e.g. pg_stat_io before PostgreSQL 16.
+	optional bool
+}
+
+var views = []view{
+	{
+		name: "pg_stat_database",
+		sql:  "SELECT * FROM pg_stat_database WHERE datname = current_database()",
+		keys: []string{"datname"},
+	},
+	{
+		name: "pg_stat_bgwriter",
+		sql:  "SELECT * FROM pg_stat_bgwriter",
+	},
+	{
+		name:     "pg_stat_wal",
+		sql:      "SELECT * FROM pg_stat_wal",
+		optional: true,
+	},
+	{
+		name:     "pg_stat_io",
+		sql:      "SELECT * FROM pg_stat_io",
+		keys:     []string{"backend_type", "object", "context"},
+		optional: true,
+	},
+	{
+		name: "pg_stat_user_tables",
+		sql:  "SELECT * FROM pg_stat_user_tables",
+		keys: []string{"schemaname", "relname"},
+	},
+	{
+		name: statementsView,
+		sql: "SELECT * FROM pg_stat_statements " +
+			"WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())",
+		// NOTE: toplevel exists since PostgreSQL 14, a statement has a row for top level and nested calls.
+		keys:     []string{"userid", "dbid", "queryid", "toplevel"},
+		optional: true,
+	},
+}
+
+// Row is a statistics view row, numeric columns are counters and other columns are labels.
+// Key columns are always labels, so numeric ids such as queryid are exact and not diffed.
+type Row struct {
+	Labels   map[string]string
+	Counters map[string]float64
+}
+
+// Snapshot holds rows of every statistics view by row key.
+type Snapshot struct {
+	Time  time.Time
+	Views map[string]map[string]Row
+}
+
+// Take snapshots statistics views, optional views which are missing are skipped.
+func Take(ctx context.Context, querier Querier, logger *zap.Logger) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Time:  time.Now(),
+		Views: make(map[string]map[string]Row, len(views)),
+	}
+
+	for _, v := range views {
+		rows, err := takeView(ctx, querier, v)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if v.optional && errors.As(err, &pgErr) && pgErr.Code == sqlStateUndefinedTable {
+				logger.Debug("statistics view is not available", zap.String("view", v.name))
+
+				continue
+			}
+
+			return nil, fmt.Errorf("snapshot %s: %w", v.name, err)
+		}
+
+		snapshot.Views[v.name] = rows
+	}
+
+	return snapshot, nil
+}
+
+func takeView(ctx context.Context, querier Querier, v view) (map[string]Row, error) {
+	rows, err := querier.Query(ctx, v.sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]Row)
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+
+		row := Row{
+			Labels:   make(map[string]string),
+			Counters: make(map[string]float64),
+		}
+
+		for i, field := range rows.FieldDescriptions() {
+			if slices.Contains(v.keys, field.Name) {
+				if values[i] != nil {
+					row.Labels[field.Name] = fmt.Sprint(values[i])
+				}
+			} else if counter, ok := toCounter(values[i]); ok {
+				row.Counters[field.Name] = counter
+			} else if values[i] != nil {
+				row.Labels[field.Name] = fmt.Sprint(values[i])
+			}
+		}
+
+		result[rowKey(v, row)] = row
+	}
+
+	return result, rows.Err()
+}
+
+func rowKey(v view, row Row) string {
+	parts := make([]string, len(v.keys))
+
+	for i, key := range v.keys {
+		parts[i] = row.Labels[key]
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func toCounter(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			return 0, false
+		}
+
+		return f.Float64, true
+	default:
+		return 0, false
+	}
+}
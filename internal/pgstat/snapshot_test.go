@@ -0,0 +1,97 @@
+package pgstat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+)
+
+func expectViews(mock pgxmock.PgxPoolIface, xactCommit int64, seqScan int64, calls int64) {
+	mock.ExpectQuery(views[0].sql).WillReturnRows(
+		mock.NewRows([]string{"datname", "xact_commit"}).AddRow("db", xactCommit),
+	)
+	mock.ExpectQuery(views[1].sql).WillReturnRows(
+		mock.NewRows([]string{"buffers_clean"}).AddRow(int64(7)),
+	)
+	mock.ExpectQuery(views[2].sql).WillReturnError(&pgconn.PgError{Code: sqlStateUndefinedTable})
+	mock.ExpectQuery(views[3].sql).WillReturnError(&pgconn.PgError{Code: sqlStateUndefinedTable})
+	mock.ExpectQuery(views[4].sql).WillReturnRows(
+		mock.NewRows([]string{"schemaname", "relname", "seq_scan"}).AddRow("public", "t", seqScan),
+	)
+	mock.ExpectQuery(views[5].sql).WillReturnRows(
+		mock.NewRows([]string{"userid", "dbid", "queryid", "toplevel", "query", "calls", "total_exec_time"}).
+			AddRow(uint32(10), uint32(5), int64(1), true, "SELECT 1", calls, float64(calls)*2).
+			AddRow(uint32(10), uint32(5), int64(1), false, "SELECT 1", int64(3), float64(1)).
+			AddRow(uint32(10), uint32(5), int64(2), true, "SELECT 2", int64(5), float64(1)),
+	)
+}
+
+func TestTakeAndDiff(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+
+	expectViews(mock, 100, 3, 1)
+	before, err := Take(ctx, mock, logger.Global())
+	require.NoError(t, err)
+	require.NotContains(t, before.Views, "pg_stat_io")
+	require.Contains(t, before.Views["pg_stat_user_tables"], "public.t")
+	require.Len(t, before.Views[statementsView], 3)
+	require.Contains(t, before.Views[statementsView], "10.5.1.false")
+
+	expectViews(mock, 150, 3, 11)
+	after, err := Take(ctx, mock, logger.Global())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	after.Time = before.Time.Add(time.Minute)
+	report := Diff(before, after, 10)
+
+	require.Equal(t, map[string]float64{"xact_commit": 50}, report.Views["pg_stat_database"]["db"])
+	require.Empty(t, report.Views["pg_stat_bgwriter"])
+	require.Empty(t, report.Views["pg_stat_user_tables"])
+	require.NotContains(t, report.Views, statementsView)
+	require.Equal(t, []Statement{{
+		Query:  "SELECT 1",
+		Deltas: map[string]float64{"calls": 10, "total_exec_time": 20},
+	}}, report.TopStatements)
+}
+
+func TestTake_RequiredViewError(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	mock.ExpectQuery(views[0].sql).WillReturnError(&pgconn.PgError{Code: "42501"})
+
+	_, err = Take(context.Background(), mock, logger.Global())
+	require.ErrorContains(t, err, "snapshot pg_stat_database")
+}
+
+func TestDiff_TopStatements(t *testing.T) {
+	statement := func(query string, total float64) Row {
+		return Row{
+			Labels:   map[string]string{queryLabel: query},
+			Counters: map[string]float64{"total_time": total},
+		}
+	}
+
+	after := &Snapshot{Views: map[string]map[string]Row{statementsView: {
+		"1": statement("a", 1),
+		"2": statement("b", 3),
+		"3": statement("c", 2),
+	}}}
+
+	report := Diff(&Snapshot{}, after, 2)
+	require.Len(t, report.TopStatements, 2)
+	require.Equal(t, "b", report.TopStatements[0].Query)
+	require.Equal(t, "c", report.TopStatements[1].Query)
+}
@@ -0,0 +1,159 @@
+package pgstat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// activityQueryKeyLen is shorter than the default track_activity_query_size,
+	// so SQL truncated by pg_stat_activity is still found by its prefix.
+	activityQueryKeyLen = 1000
+	// waitEventCPU marks active backends without wait event, they are on CPU or in a not instrumented wait.
+	waitEventCPU = "CPU"
+	// unknownQuery labels backends running SQL not registered in the sampler.
+	unknownQuery = "unknown"
+)
+
+const sampleWaitsSQL = `SELECT query, coalesce(wait_event_type, ''), coalesce(wait_event, '')
+FROM pg_stat_activity
+WHERE application_name = $1 AND pid <> pg_backend_pid() AND state <> 'idle'`
+
+// WaitSampler polls pg_stat_activity for backends of the given application_name
+// and counts their wait events by query name.
+type WaitSampler struct {
+	querier         Querier
+	applicationName string
+	interval        time.Duration
+	logger          *zap.Logger
+	// names maps SQL prefix to the query name.
+	names cmap.ConcurrentMap[string, string]
+
+	mu      sync.Mutex
+	samples uint64
+	counts  map[string]map[string]uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WaitProfile is the number of samples of every wait event by query name.
+// Wait events are formatted as "type:event", "CPU" means no wait.
+type WaitProfile struct {
+	Samples uint64                       `json:"samples"`
+	Queries map[string]map[string]uint64 `json:"queries"`
+}
+
+func NewWaitSampler(
+	querier Querier,
+	applicationName string,
+	interval time.Duration,
+	logger *zap.Logger,
+) *WaitSampler {
+	return &WaitSampler{
+		querier:         querier,
+		applicationName: applicationName,
+		interval:        interval,
+		logger:          logger,
+		names:           cmap.New[string](),
+		counts:          make(map[string]map[string]uint64),
+	}
+}
+
+func queryKey(sql string) string {
+	return sql[:min(len(sql), activityQueryKeyLen)]
+}
+
+// Register remembers the query name of the SQL, it is cheap for already registered SQL.
+func (s *WaitSampler) Register(sql, name string) {
+	key := queryKey(sql)
+	if !s.names.Has(key) {
+		s.names.SetIfAbsent(key, name)
+	}
+}
+
+// Start polls pg_stat_activity every interval until Stop.
+func (s *WaitSampler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.sample(context.Background()); err != nil {
+					s.logger.Warn("failed to sample wait events", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+func (s *WaitSampler) sample(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+
+	rows, err := s.querier.Query(ctx, sampleWaitsSQL, s.applicationName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for rows.Next() {
+		var sql, waitType, waitEvent string
+		if err = rows.Scan(&sql, &waitType, &waitEvent); err != nil {
+			return err
+		}
+
+		name, ok := s.names.Get(queryKey(sql))
+		if !ok {
+			name = unknownQuery
+		}
+
+		event := waitEventCPU
+		if waitType != "" {
+			event = waitType + ":" + waitEvent
+		}
+
+		if s.counts[name] == nil {
+			s.counts[name] = make(map[string]uint64)
+		}
+
+		s.counts[name][event]++
+	}
+
+	s.samples++
+
+	return rows.Err()
+}
+
+// Stop stops polling and returns the collected profile.
+func (s *WaitSampler) Stop() *WaitProfile {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &WaitProfile{
+		Samples: s.samples,
+		Queries: s.counts,
+	}
+}
@@ -0,0 +1,70 @@
+package pgstat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+)
+
+func TestWaitSampler(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	longSQL := "SELECT " + strings.Repeat("a, ", 1000) + "b FROM t"
+
+	sampler := NewWaitSampler(mock, "stroppy-postgres-1", time.Second, logger.Global())
+	sampler.Register("UPDATE t SET a = $1", "payment")
+	sampler.Register(longSQL, "report")
+	sampler.Register(longSQL, "other_name")
+
+	mock.ExpectQuery(sampleWaitsSQL).WithArgs("stroppy-postgres-1").WillReturnRows(
+		mock.NewRows([]string{"query", "wait_event_type", "wait_event"}).
+			AddRow("UPDATE t SET a = $1", "Lock", "transactionid").
+			AddRow("UPDATE t SET a = $1", "", "").
+			AddRow(longSQL[:1023], "IO", "DataFileRead").
+			AddRow("SELECT now()", "Client", "ClientRead"),
+	)
+	require.NoError(t, sampler.sample(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, &WaitProfile{
+		Samples: 1,
+		Queries: map[string]map[string]uint64{
+			"payment":    {"Lock:transactionid": 1, waitEventCPU: 1},
+			"report":     {"IO:DataFileRead": 1},
+			unknownQuery: {"Client:ClientRead": 1},
+		},
+	}, sampler.Stop())
+}
+
+func TestWaitSampler_StartStop(t *testing.T) {
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	mock.MatchExpectationsInOrder(false)
+
+	for range 3 {
+		mock.ExpectQuery(sampleWaitsSQL).WithArgs("app").
+			WillReturnRows(mock.NewRows([]string{"query", "wait_event_type", "wait_event"}))
+	}
+
+	sampler := NewWaitSampler(mock, "app", time.Millisecond, logger.Global())
+	sampler.Start()
+
+	require.Eventually(t, func() bool {
+		sampler.mu.Lock()
+		defer sampler.mu.Unlock()
+
+		return sampler.samples > 0
+	}, time.Second, time.Millisecond)
+
+	require.Positive(t, sampler.Stop().Samples)
+}
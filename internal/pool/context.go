@@ -0,0 +1,18 @@
+package pool
+
+import "context"
+
+type queryNameKey struct{}
+
+// WithQueryName attaches DriverQuery name to the context of a query,
+// so tracers can tell queries apart by name instead of SQL.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// QueryName returns the name attached by WithQueryName or an empty string.
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameKey{}).(string)
+
+	return name
+}
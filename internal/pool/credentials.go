@@ -0,0 +1,297 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgpassfile"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+// credentials_provider replaces the static URL password with one fetched for every new connection:
+// "pgpass" looks it up in credentials_pgpass (PGPASSFILE or ~/.pgpass by default),
+// "command" runs credentials_command with sh and caches its output for credentials_refresh,
+// "file" reads credentials_file.
+// Files are read again once they change, so rotated passwords are used by the next connection.
+const (
+	credentialsProviderKey = "credentials_provider"
+	credentialsPgpassKey   = "credentials_pgpass"
+	credentialsCommandKey  = "credentials_command"
+	credentialsRefreshKey  = "credentials_refresh"
+	credentialsFileKey     = "credentials_file"
+)
+
+const (
+	CredentialsProviderPgpass  = "pgpass"
+	CredentialsProviderCommand = "command"
+	CredentialsProviderFile    = "file"
+)
+
+const (
+	defaultCredentialsRefresh = time.Minute
+	credentialsCommandTimeout = 30 * time.Second
+)
+
+var ErrNoCredentials = errors.New("no credentials")
+
+// CredentialProvider returns the password for a new connection to the server of connConfig.
+type CredentialProvider interface {
+	Password(ctx context.Context, connConfig *pgconn.Config) (string, error)
+}
+
+// parseCredentialProvider returns nil when "credentials_provider" is not set.
+func parseCredentialProvider(
+	cfgMap map[string]any,
+	logger *zap.Logger,
+) (CredentialProvider, error) { //nolint: ireturn // providers differ
+	rawAny, exists := cfgMap[credentialsProviderKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // the URL password is used
+	}
+
+	str := func(key string) (string, bool, error) {
+		rawAny, exists := cfgMap[key]
+		if !exists {
+			return "", false, nil
+		}
+
+		value, ok := config.String(rawAny)
+		if !ok || value == "" {
+			return "", false, fmt.Errorf(`"%s" must be a non-empty string, got %v: %w`, key, rawAny, ErrUnsupportedParam)
+		}
+
+		return value, true, nil
+	}
+
+	required := func(key, provider string) (string, error) {
+		value, ok, err := str(key)
+		if err == nil && !ok {
+			err = fmt.Errorf(`"%s" provider requires "%s": %w`, provider, key, ErrUnsupportedParam)
+		}
+
+		return value, err
+	}
+
+	logger = logger.Named("credentials")
+
+	switch provider, _ := config.String(rawAny); provider {
+	case CredentialsProviderPgpass:
+		path, ok, err := str(credentialsPgpassKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			if path, err = defaultPgpassPath(); err != nil {
+				return nil, err
+			}
+		}
+
+		return &pgpassProvider{file: newWatchedFile(path, logger)}, nil
+	case CredentialsProviderCommand:
+		command, err := required(credentialsCommandKey, provider)
+		if err != nil {
+			return nil, err
+		}
+
+		refresh := defaultCredentialsRefresh
+
+		if rawAny, exists := cfgMap[credentialsRefreshKey]; exists {
+			var ok bool
+			if refresh, ok = config.Duration(rawAny); !ok || refresh < 0 {
+				return nil, fmt.Errorf(`"%s" must be a non-negative duration string, got %v: %w`,
+					credentialsRefreshKey, rawAny, ErrUnsupportedParam)
+			}
+		}
+
+		return &commandProvider{command: command, refresh: refresh, logger: logger}, nil
+	case CredentialsProviderFile:
+		path, err := required(credentialsFileKey, provider)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fileProvider{file: newWatchedFile(path, logger)}, nil
+	default:
+		return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+			rawAny, credentialsProviderKey,
+			[]string{CredentialsProviderPgpass, CredentialsProviderCommand, CredentialsProviderFile},
+			ErrUnsupportedParam,
+		)
+	}
+}
+
+// defaultPgpassPath follows libpq: PGPASSFILE or ~/.pgpass.
+func defaultPgpassPath() (string, error) {
+	if path := os.Getenv("PGPASSFILE"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf(`"%s" is not set and home directory is unknown: %w`, credentialsPgpassKey, err)
+	}
+
+	return filepath.Join(home, ".pgpass"), nil
+}
+
+// watchedFile caches the file content until its modification time or size changes.
+type watchedFile struct {
+	path   string
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	data    []byte
+	read    bool
+}
+
+func newWatchedFile(path string, logger *zap.Logger) *watchedFile {
+	return &watchedFile{path: path, logger: logger}
+}
+
+// content returns the file data, reading it again after a change.
+func (f *watchedFile) content() ([]byte, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.read && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.data, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.read {
+		f.logger.Info("credentials file changed", zap.String("path", f.path))
+	}
+
+	f.modTime, f.size, f.data, f.read = info.ModTime(), info.Size(), data, true
+
+	return data, nil
+}
+
+type pgpassProvider struct {
+	file *watchedFile
+}
+
+func (p *pgpassProvider) Password(_ context.Context, connConfig *pgconn.Config) (string, error) {
+	data, err := p.file.content()
+	if err != nil {
+		return "", err
+	}
+
+	passfile, err := pgpassfile.ParsePassfile(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	host := connConfig.Host
+	// NOTE: like libpq, unix sockets match "localhost" entries.
+	if network, _ := pgconn.NetworkAddress(host, connConfig.Port); network == "unix" {
+		host = "localhost"
+	}
+
+	password := passfile.FindPassword(host, fmt.Sprint(connConfig.Port), connConfig.Database, connConfig.User)
+	if password == "" {
+		return "", fmt.Errorf("%s has no entry for %s@%s:%d/%s: %w",
+			p.file.path, connConfig.User, host, connConfig.Port, connConfig.Database, ErrNoCredentials)
+	}
+
+	return password, nil
+}
+
+type fileProvider struct {
+	file *watchedFile
+}
+
+func (p *fileProvider) Password(context.Context, *pgconn.Config) (string, error) {
+	data, err := p.file.content()
+	if err != nil {
+		return "", err
+	}
+
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("%s is empty: %w", p.file.path, ErrNoCredentials)
+	}
+
+	return password, nil
+}
+
+// commandProvider runs the command for a token, e.g. an IAM auth token, and reuses it for refresh.
+// When the command fails the previous token is used until it is replaced.
+type commandProvider struct {
+	command string
+	refresh time.Duration
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	token   string
+	fetched time.Time
+}
+
+func (p *commandProvider) Password(ctx context.Context, _ *pgconn.Config) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Since(p.fetched) < p.refresh {
+		return p.token, nil
+	}
+
+	token, err := p.run(ctx)
+	if err != nil {
+		if p.token != "" {
+			p.logger.Warn("credentials command failed, using previous token", zap.Error(err))
+
+			return p.token, nil
+		}
+
+		return "", err
+	}
+
+	p.token, p.fetched = token, time.Now()
+
+	return token, nil
+}
+
+func (p *commandProvider) run(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialsCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.command) //nolint: gosec // the command is configured by the user
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("credentials command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("credentials command printed nothing: %w", ErrNoCredentials)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,242 @@
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+const (
+	// target_session_attrs overrides the URL parameter of the same name.
+	targetSessionAttrsKey = "target_session_attrs"
+	// failover_report is a path of JSON file with failover events written on Stop.
+	failoverReportKey = "failover_report"
+)
+
+const failoverReportFileMode = 0o644
+
+var targetSessionAttrs = map[string]pgconn.ValidateConnectFunc{
+	"any":            nil,
+	"read-write":     pgconn.ValidateConnectTargetSessionAttrsReadWrite,
+	"read-only":      pgconn.ValidateConnectTargetSessionAttrsReadOnly,
+	"primary":        pgconn.ValidateConnectTargetSessionAttrsPrimary,
+	"standby":        pgconn.ValidateConnectTargetSessionAttrsStandby,
+	"prefer-standby": pgconn.ValidateConnectTargetSessionAttrsPreferStandby,
+}
+
+// FailoverEvent is an outage seen by the driver, from the first failed transaction to the first successful one.
+type FailoverEvent struct {
+	Started   time.Time     `json:"started"`
+	Recovered time.Time     `json:"recovered"`
+	Downtime  time.Duration `json:"downtime_ns"`
+	// FromHost and ToHost are server addresses of the last connection before and after the outage.
+	FromHost string `json:"from_host"`
+	ToHost   string `json:"to_host"`
+	Error    string `json:"error"`
+}
+
+// FailoverMonitor measures outages of a multi-host pool.
+// On the first outage error it resets the pool, so connections still open to a demoted primary
+// are replaced with ones validated against target_session_attrs.
+type FailoverMonitor struct {
+	logger     *zap.Logger
+	reportPath string
+	reset      func()
+
+	host atomic.Pointer[string]
+	down atomic.Bool
+
+	mu     sync.Mutex
+	outage FailoverEvent
+	events []FailoverEvent
+}
+
+// parseFailover applies target_session_attrs and returns the monitor
+// when the pool may fail over: several hosts or target_session_attrs is set.
+func parseFailover(
+	cfgMap map[string]any,
+	connConfig *pgconn.Config,
+	logger *zap.Logger,
+) (*FailoverMonitor, error) {
+	// NOTE: pgx turns target_session_attrs of the URL into ValidateConnect.
+	tsaInURL := connConfig.ValidateConnect != nil
+
+	rawAny, tsaExists := cfgMap[targetSessionAttrsKey]
+	if tsaExists {
+		validate, ok := targetSessionAttrs[fmt.Sprint(rawAny)]
+		if !ok {
+			return nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+				rawAny, targetSessionAttrsKey,
+				[]string{"any", "read-write", "read-only", "primary", "standby", "prefer-standby"},
+				ErrUnsupportedParam,
+			)
+		}
+
+		connConfig.ValidateConnect = validate
+	}
+
+	var reportPath string
+
+	if rawAny, exists := cfgMap[failoverReportKey]; exists {
+		var ok bool
+		if reportPath, ok = config.String(rawAny); !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`, failoverReportKey, rawAny, ErrUnsupportedParam)
+		}
+	}
+
+	if !tsaExists && !tsaInURL && !multiHost(connConfig) && reportPath == "" {
+		return nil, nil //nolint: nilnil // single host pool does not fail over
+	}
+
+	return &FailoverMonitor{
+		logger:     logger.Named("failover"),
+		reportPath: reportPath,
+	}, nil
+}
+
+// multiHost reports whether fallbacks point to other servers,
+// fallbacks of sslmode=prefer repeat the same host.
+func multiHost(connConfig *pgconn.Config) bool {
+	for _, fallback := range connConfig.Fallbacks {
+		if fallback.Host != connConfig.Host || fallback.Port != connConfig.Port {
+			return true
+		}
+	}
+
+	return false
+}
+
+// connected remembers the server of a new pool connection.
+func (m *FailoverMonitor) connected(conn *pgconn.PgConn) {
+	if m == nil || conn.Conn() == nil {
+		return
+	}
+
+	host := conn.Conn().RemoteAddr().String()
+
+	if previous := m.host.Swap(&host); previous != nil && *previous != host {
+		m.logger.Info("connected to another server", zap.String("from", *previous), zap.String("to", host))
+	}
+}
+
+func (m *FailoverMonitor) currentHost() string {
+	if host := m.host.Load(); host != nil {
+		return *host
+	}
+
+	return ""
+}
+
+// Failed marks the start of an outage, err must be a connection loss or a write to a demoted primary.
+func (m *FailoverMonitor) Failed(err error) {
+	if m == nil || m.down.Load() {
+		return
+	}
+
+	m.mu.Lock()
+
+	if m.down.Load() {
+		m.mu.Unlock()
+
+		return
+	}
+
+	host := m.currentHost()
+	m.outage = FailoverEvent{
+		Started:  time.Now(),
+		FromHost: host,
+		Error:    err.Error(),
+	}
+	m.down.Store(true)
+	m.mu.Unlock()
+
+	m.logger.Warn("server unavailable, resetting pool", zap.String("host", host), zap.Error(err))
+
+	if m.reset != nil {
+		m.reset()
+	}
+}
+
+// Succeeded ends the outage, if any, and records its downtime.
+func (m *FailoverMonitor) Succeeded() {
+	if m == nil || !m.down.Load() {
+		return
+	}
+
+	m.mu.Lock()
+
+	if !m.down.Load() {
+		m.mu.Unlock()
+
+		return
+	}
+
+	event := m.outage
+	event.Recovered = time.Now()
+	event.Downtime = event.Recovered.Sub(event.Started)
+	event.ToHost = m.currentHost()
+
+	m.events = append(m.events, event)
+	m.down.Store(false)
+	m.mu.Unlock()
+
+	m.logger.Info("server available again",
+		zap.String("from", event.FromHost),
+		zap.String("to", event.ToHost),
+		zap.Duration("downtime", event.Downtime))
+}
+
+// Down reports whether an outage is in progress.
+func (m *FailoverMonitor) Down() bool {
+	return m != nil && m.down.Load()
+}
+
+// Events returns finished outages.
+func (m *FailoverMonitor) Events() []FailoverEvent {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]FailoverEvent(nil), m.events...)
+}
+
+// Stop logs the outages and writes them to the report file if set.
+func (m *FailoverMonitor) Stop() error {
+	if m == nil {
+		return nil
+	}
+
+	events := m.Events()
+
+	var total time.Duration
+	for _, event := range events {
+		total += event.Downtime
+	}
+
+	m.logger.Info("failover report",
+		zap.Int("failovers", len(events)),
+		zap.Duration("downtime", total),
+		zap.Bool("down", m.Down()))
+
+	if m.reportPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(m.reportPath, data, failoverReportFileMode)
+}
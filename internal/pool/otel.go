@@ -0,0 +1,279 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+const (
+	otelExporterKey    = "otel_exporter"
+	otelEndpointKey    = "otel_endpoint"
+	otelInsecureKey    = "otel_insecure"
+	otelFileKey        = "otel_file"
+	otelServiceNameKey = "otel_service_name"
+)
+
+const (
+	otelExporterOTLP = "otlp"
+	otelExporterFile = "file"
+
+	defaultOtelServiceName = "stroppy-postgres"
+	otelTracerName         = "github.com/stroppy-io/stroppy-postgres/internal/pool"
+	otelShutdownTimeout    = 5 * time.Second
+	otelFileMode           = 0o644
+)
+
+const (
+	attrDBSystem     = attribute.Key("db.system.name")
+	attrDBNamespace  = attribute.Key("db.namespace")
+	attrDBQueryText  = attribute.Key("db.query.text")
+	attrDBStatusCode = attribute.Key("db.response.status_code")
+	attrDBRows       = attribute.Key("db.response.rows_affected")
+	attrDBCollection = attribute.Key("db.collection.name")
+	attrServerAddr   = attribute.Key("server.address")
+	attrServerPort   = attribute.Key("server.port")
+	attrQueryName    = attribute.Key("stroppy.query.name")
+)
+
+var ErrOtelFileRequired = fmt.Errorf(`"%s" is required for "%s" set to "%s"`,
+	otelFileKey, otelExporterKey, otelExporterFile)
+
+// otelTracer emits OpenTelemetry client spans for queries, batches, copies and connects.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+var (
+	_ pgx.QueryTracer    = (*otelTracer)(nil)
+	_ pgx.BatchTracer    = (*otelTracer)(nil)
+	_ pgx.CopyFromTracer = (*otelTracer)(nil)
+	_ pgx.ConnectTracer  = (*otelTracer)(nil)
+)
+
+// newOtelTracer builds tracer with exporter chosen by "otel_exporter",
+// nil tracer is returned when the key is not set.
+// Returned closer flushes pending spans and must be called after the pool is closed.
+func newOtelTracer(cfgMap map[string]any) (*otelTracer, func(), error) {
+	rawAny, exists := cfgMap[otelExporterKey]
+	if !exists {
+		return nil, nil, nil
+	}
+
+	serviceName := defaultOtelServiceName
+	if name, ok := config.String(cfgMap[otelServiceNameKey]); ok {
+		serviceName = name
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		closers  []io.Closer
+		err      error
+	)
+
+	switch rawAny {
+	case otelExporterOTLP:
+		opts := make([]otlptracegrpc.Option, 0, 2) //nolint: mnd // endpoint and insecure
+		if endpoint, ok := config.String(cfgMap[otelEndpointKey]); ok {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+
+		if insecure, ok := config.Bool(cfgMap[otelInsecureKey]); ok && insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		// NOTE: client connects lazily, so the context only bounds exporter creation.
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+	case otelExporterFile:
+		path, ok := config.String(cfgMap[otelFileKey])
+		if !ok || path == "" {
+			return nil, nil, ErrOtelFileRequired
+		}
+
+		file, openErr := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, otelFileMode)
+		if openErr != nil {
+			return nil, nil, openErr
+		}
+
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, nil, errors.Join(err, file.Close())
+		}
+
+		closers = append(closers, file)
+	default:
+		return nil, nil, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+			rawAny, otelExporterKey,
+			[]string{otelExporterOTLP, otelExporterFile},
+			ErrUnsupportedParam,
+		)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	closer := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+		defer cancel()
+
+		_ = provider.Shutdown(ctx)
+
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}
+
+	return &otelTracer{tracer: provider.Tracer(otelTracerName)}, closer, nil
+}
+
+func (t *otelTracer) start(
+	ctx context.Context,
+	conn *pgx.Conn,
+	operation string,
+	attrs ...attribute.KeyValue,
+) context.Context {
+	attrs = append(attrs, attrDBSystem.String("postgresql"))
+
+	if conn != nil {
+		cfg := conn.Config()
+		attrs = append(attrs,
+			attrDBNamespace.String(cfg.Database),
+			attrServerAddr.String(cfg.Host),
+			attrServerPort.Int(int(cfg.Port)),
+		)
+	}
+
+	name := QueryName(ctx)
+	if name != "" {
+		attrs = append(attrs, attrQueryName.String(name))
+		operation += " " + name
+	}
+
+	ctx, _ = t.tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx
+}
+
+func endSpan(span trace.Span, tag pgconn.CommandTag, err error) {
+	recordResult(span, tag, err)
+	span.End()
+}
+
+func recordResult(span trace.Span, tag pgconn.CommandTag, err error) {
+	if err == nil {
+		span.SetAttributes(attrDBRows.Int64(tag.RowsAffected()))
+
+		return
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		span.SetAttributes(attrDBStatusCode.String(pgErr.Code))
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func (t *otelTracer) TraceQueryStart(
+	ctx context.Context,
+	conn *pgx.Conn,
+	data pgx.TraceQueryStartData,
+) context.Context {
+	return t.start(ctx, conn, "query", attrDBQueryText.String(data.SQL))
+}
+
+func (t *otelTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.CommandTag, data.Err)
+}
+
+func (t *otelTracer) TraceBatchStart(
+	ctx context.Context,
+	conn *pgx.Conn,
+	data pgx.TraceBatchStartData,
+) context.Context {
+	return t.start(ctx, conn, "batch", attribute.Int("db.operation.batch.size", data.Batch.Len()))
+}
+
+// TraceBatchQuery adds every batch query as an event of the batch span.
+func (t *otelTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	attrs := []attribute.KeyValue{attrDBQueryText.String(data.SQL)}
+
+	var pgErr *pgconn.PgError
+
+	switch {
+	case data.Err == nil:
+		attrs = append(attrs, attrDBRows.Int64(data.CommandTag.RowsAffected()))
+	case errors.As(data.Err, &pgErr):
+		attrs = append(attrs, attrDBStatusCode.String(pgErr.Code))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("query", trace.WithAttributes(attrs...))
+}
+
+func (t *otelTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	endSpan(trace.SpanFromContext(ctx), pgconn.CommandTag{}, data.Err)
+}
+
+func (t *otelTracer) TraceCopyFromStart(
+	ctx context.Context,
+	conn *pgx.Conn,
+	data pgx.TraceCopyFromStartData,
+) context.Context {
+	return t.start(ctx, conn, "copy",
+		attrDBCollection.String(data.TableName.Sanitize()),
+		attribute.String("db.copy.columns", strings.Join(data.ColumnNames, ",")),
+	)
+}
+
+func (t *otelTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	endSpan(trace.SpanFromContext(ctx), data.CommandTag, data.Err)
+}
+
+func (t *otelTracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "connect",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrDBSystem.String("postgresql"),
+			attrDBNamespace.String(data.ConnConfig.Database),
+			attrServerAddr.String(data.ConnConfig.Host),
+			attrServerPort.Int(int(data.ConnConfig.Port)),
+		),
+	)
+
+	return ctx
+}
+
+func (t *otelTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+
+	span.End()
+}
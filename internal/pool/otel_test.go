@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOtelTracer(t *testing.T) {
+	tracer, closer, err := newOtelTracer(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, tracer)
+	require.Nil(t, closer)
+
+	_, _, err = newOtelTracer(map[string]any{otelExporterKey: "jaeger"})
+	require.ErrorIs(t, err, ErrUnsupportedParam)
+
+	_, _, err = newOtelTracer(map[string]any{otelExporterKey: otelExporterFile})
+	require.ErrorIs(t, err, ErrOtelFileRequired)
+
+	tracer, closer, err = newOtelTracer(map[string]any{
+		otelExporterKey: otelExporterOTLP,
+		otelEndpointKey: "localhost:4317",
+		otelInsecureKey: true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, tracer)
+	closer()
+}
+
+func TestOtelTracer_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	tracer, closer, err := newOtelTracer(map[string]any{
+		otelExporterKey:    otelExporterFile,
+		otelFileKey:        path,
+		otelServiceNameKey: "test-service",
+	})
+	require.NoError(t, err)
+
+	ctx := WithQueryName(context.Background(), "new_order")
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "INSERT INTO t VALUES ($1)"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "23505"}})
+
+	ctx = tracer.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{
+		TableName:   pgx.Identifier{"public", "t"},
+		ColumnNames: []string{"a", "b"},
+	})
+	tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{CommandTag: pgconn.NewCommandTag("COPY 2")})
+
+	closer()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"query new_order"`)
+	require.Contains(t, string(data), `"23505"`)
+	require.Contains(t, string(data), `"Name":"copy"`)
+	require.Contains(t, string(data), `"test-service"`)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"os"
 	"slices"
 	"time"
 
@@ -17,6 +18,8 @@ import (
 
 	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
 	"github.com/stroppy-io/stroppy-core/pkg/protovalue"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
 )
 
 const (
@@ -24,6 +27,11 @@ const (
 	DriverLoggerName = "postgres-driver"
 )
 
+const (
+	applicationNameParam   = "application_name"
+	defaultApplicationName = "stroppy-postgres"
+)
+
 const (
 	traceLogLevelKey   = "trace_log_level"
 	maxConnLifetimeKey = "max_conn_lifetime"
@@ -37,6 +45,42 @@ const (
 	statementCacheCapacityKey   = "statement_cache_capacity"
 )
 
+// Schema lists db_specific keys read by the pool.
+var Schema = config.Schema{
+	traceLogLevelKey:            config.KindString,
+	maxConnLifetimeKey:          config.KindDuration,
+	maxConnIdleTimeKey:          config.KindDuration,
+	maxConnsKey:                 config.KindInt,
+	minConnsKey:                 config.KindInt,
+	minIdleConnsKey:             config.KindInt,
+	defaultQueryExecModeKey:     config.KindString,
+	descriptionCacheCapacityKey: config.KindInt,
+	statementCacheCapacityKey:   config.KindInt,
+	sessionSettingsKey:          config.KindStructOrString,
+	otelExporterKey:             config.KindString,
+	otelEndpointKey:             config.KindString,
+	otelInsecureKey:             config.KindBool,
+	otelFileKey:                 config.KindString,
+	otelServiceNameKey:          config.KindString,
+	slowQueryThresholdKey:       config.KindDuration,
+	slowQueryLogKey:             config.KindString,
+	slowQueryExplainKey:         config.KindBool,
+	slowQueryExplainAnalyzeKey:  config.KindBool,
+	targetSessionAttrsKey:       config.KindString,
+	failoverReportKey:           config.KindString,
+	tlsModeKey:                  config.KindString,
+	tlsCAKey:                    config.KindString,
+	tlsCertKey:                  config.KindString,
+	tlsKeyKey:                   config.KindString,
+	tlsServerNameKey:            config.KindString,
+	tlsMinVersionKey:            config.KindString,
+	credentialsProviderKey:      config.KindString,
+	credentialsPgpassKey:        config.KindString,
+	credentialsCommandKey:       config.KindString,
+	credentialsRefreshKey:       config.KindDuration,
+	credentialsFileKey:          config.KindString,
+}
+
 var (
 	ErrUnsupportedParam                = errors.New("unsupported parameter")
 	ErrDescriptionCacheCapacityMissUse = fmt.Errorf(
@@ -54,26 +98,73 @@ var (
 	)
 )
 
+// Config is pgxpool.Config with resources which must be released after the pool is closed.
+type Config struct {
+	*pgxpool.Config
+	closers  []func()
+	tracers  *sharedTracers
+	failover *FailoverMonitor
+	tlsStats *TLSStats
+	// credentials is nil when the URL password is used.
+	credentials CredentialProvider
+	// checkConnect makes NewPool connect at once, so AfterConnect errors fail fast.
+	checkConnect bool
+}
+
+// sharedTracers hold resources like exporters and files, so they are created once by the primary config
+// and shared with replica configs. Only the primary config closes them.
+type sharedTracers struct {
+	otel    *otelTracer
+	slowLog *slowQueryLog
+}
+
+func (c *Config) close() {
+	for _, closer := range c.closers {
+		closer()
+	}
+}
+
 func parseConfig(
-	config *stroppy.DriverConfig,
+	driverConfig *stroppy.DriverConfig,
+	logger *zap.Logger,
+) (*Config, error) {
+	return parseURLConfig(driverConfig, driverConfig.GetUrl(), nil, logger)
+}
+
+// parseURLConfig applies db_specific of the driver config to the pool of url,
+// primary is nil for the primary itself. Replica pools skip target_session_attrs and failover monitoring
+// which are about the primary, and use tracers of the primary config.
+func parseURLConfig(
+	driverConfig *stroppy.DriverConfig,
+	url string,
+	primary *Config,
 	logger *zap.Logger,
-) (*pgxpool.Config, error) {
-	cfgMap, err := protovalue.ValueStructToMap(config.GetDbSpecific())
+) (*Config, error) {
+	cfgMap, err := protovalue.ValueStructToMap(driverConfig.GetDbSpecific())
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := pgxpool.ParseConfig(config.GetUrl())
+	cfg, err := pgxpool.ParseConfig(url)
 	if err != nil {
 		return nil, err
 	}
 
-	logLevel, ok := cfgMap[traceLogLevelKey]
-	if !ok {
-		logLevel = "info"
+	var ok bool
+
+	// NOTE: unique application_name lets server side views tell backends of this run apart.
+	if cfg.ConnConfig.RuntimeParams[applicationNameParam] == "" {
+		cfg.ConnConfig.RuntimeParams[applicationNameParam] = fmt.Sprintf("%s-%d", defaultApplicationName, os.Getpid())
+	}
+
+	logLevel := "info"
+	if rawAny, exists := cfgMap[traceLogLevelKey]; exists {
+		if logLevel, ok = config.String(rawAny); !ok {
+			return nil, fmt.Errorf(`"%s" must be a string, got %v: %w`, traceLogLevelKey, rawAny, ErrUnsupportedParam)
+		}
 	}
 
-	lvl, err := zapcore.ParseLevel(logLevel.(string)) //nolint: errcheck,forcetypeassert // allow panic
+	lvl, err := zapcore.ParseLevel(logLevel)
 	if err != nil {
 		return nil, err
 	}
@@ -85,55 +176,150 @@ func parseConfig(
 		return nil, err
 	}
 
-	cfg.ConnConfig.Tracer = multitracer.New(loggerTracer)
+	for key, target := range map[string]*time.Duration{
+		maxConnLifetimeKey: &cfg.MaxConnLifetime,
+		maxConnIdleTimeKey: &cfg.MaxConnIdleTime,
+	} {
+		if rawAny, exists := cfgMap[key]; exists {
+			if *target, ok = config.Duration(rawAny); !ok {
+				return nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`, key, rawAny, ErrUnsupportedParam)
+			}
+		}
+	}
 
-	maxConnLifetime, ok := cfgMap[maxConnLifetimeKey]
-	if ok {
-		d, err := time.ParseDuration(maxConnLifetime.(string)) //nolint: errcheck,forcetypeassert // allow panic
-		if err != nil {
-			return nil, err
+	for key, target := range map[string]*int32{
+		maxConnsKey:     &cfg.MaxConns,
+		minConnsKey:     &cfg.MinConns,
+		minIdleConnsKey: &cfg.MinIdleConns,
+	} {
+		if rawAny, exists := cfgMap[key]; exists {
+			if *target, ok = config.Int32(rawAny); !ok || *target < 0 {
+				return nil, fmt.Errorf(`"%s" must be a non-negative integer, got %v: %w`, key, rawAny, ErrUnsupportedParam)
+			}
 		}
+	}
+
+	err = parsePgxOptimizations(cfgMap, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := parseSessionSettings(cfgMap, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings != nil {
+		settings.startupParams(cfg.ConnConfig.RuntimeParams)
+	}
+
+	tlsOpts, err := parseTLS(cfgMap)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsOpts.apply(&cfg.ConnConfig.Config)
+
+	tlsStats := newTLSStats(logger.Named("tls"))
+	cfg.ConnConfig.DialFunc = wrapDial(cfg.ConnConfig.DialFunc)
+
+	credentials, err := parseCredentialProvider(cfgMap, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if credentials != nil {
+		cfg.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+			password, err := credentials.Password(ctx, &connConfig.Config)
+			if err != nil {
+				return err
+			}
 
-		cfg.MaxConnLifetime = d
+			connConfig.Password = password
+
+			return nil
+		}
 	}
 
-	maxConnIdleTime, ok := cfgMap[maxConnIdleTimeKey]
-	if ok {
-		d, err := time.ParseDuration(maxConnIdleTime.(string)) //nolint: errcheck,forcetypeassert // allow panic
+	var failover *FailoverMonitor
+
+	if primary == nil {
+		failover, err = parseFailover(cfgMap, &cfg.ConnConfig.Config, logger)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		pgxdecimal.Register(conn.TypeMap())
+		failover.connected(conn.PgConn())
+		tlsStats.connected(conn.PgConn())
+
+		if settings != nil {
+			return settings.apply(ctx, conn)
+		}
 
-		cfg.MaxConnIdleTime = d
+		return nil
 	}
 
-	maxConns, ok := cfgMap[maxConnsKey]
-	if ok {
-		cfg.MaxConns = maxConns.(int32) //nolint: errcheck,forcetypeassert // allow panic
+	parsed := &Config{
+		Config:       cfg,
+		failover:     failover,
+		tlsStats:     tlsStats,
+		credentials:  credentials,
+		checkConnect: settings != nil,
 	}
+	tracers := []pgx.QueryTracer{loggerTracer}
 
-	minConns, ok := cfgMap[minConnsKey]
-	if ok {
-		cfg.MinConns = minConns.(int32) //nolint: errcheck,forcetypeassert // allow panic
+	parsed.tracers, err = parsed.parseTracers(cfgMap, primary, logger)
+	if err != nil {
+		return nil, err
 	}
 
-	minIdleConns, ok := cfgMap[minIdleConnsKey]
-	if ok {
-		cfg.MinIdleConns = minIdleConns.(int32) //nolint: errcheck,forcetypeassert // allow panic
+	if parsed.tracers.otel != nil {
+		tracers = append(tracers, parsed.tracers.otel)
 	}
 
-	err = parsePgxOptimizations(cfgMap, cfg)
+	if parsed.tracers.slowLog != nil {
+		// NOTE: explain connections get credentials and session settings, so plans are taken with GUCs
+		// of the workload, but skip AfterConnect stats.
+		connect := settings.connect(connectWith(cfg.ConnConfig.Copy(), cfg.BeforeConnect))
+		tracers = append(tracers, parsed.tracers.slowLog.tracer(connect))
+	}
+
+	cfg.ConnConfig.Tracer = multitracer.New(tracers...)
+
+	return parsed, nil
+}
+
+// parseTracers returns tracers of the primary config or creates them and adds their closers to the config.
+// NOTE: they are created last, so nothing leaks on config errors.
+func (c *Config) parseTracers(cfgMap map[string]any, primary *Config, logger *zap.Logger) (*sharedTracers, error) {
+	if primary != nil {
+		return primary.tracers, nil
+	}
+
+	otelTracer, otelCloser, err := newOtelTracer(cfgMap)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg.AfterConnect = func(_ context.Context, conn *pgx.Conn) error {
-		pgxdecimal.Register(conn.TypeMap())
+	if otelTracer != nil {
+		c.closers = append(c.closers, otelCloser)
+	}
 
-		return nil
+	slowLog, slowCloser, err := newSlowQueryLog(cfgMap, logger)
+	if err != nil {
+		c.close()
+
+		return nil, err
+	}
+
+	if slowLog != nil {
+		c.closers = append(c.closers, slowCloser)
 	}
 
-	return cfg, nil
+	return &sharedTracers{otel: otelTracer, slowLog: slowLog}, nil
 }
 
 func parsePgxOptimizations(cfgMap map[string]any, cfg *pgxpool.Config) error {
@@ -143,9 +329,7 @@ func parsePgxOptimizations(cfgMap map[string]any, cfg *pgxpool.Config) error {
 	)
 
 	if rawAny, exists := cfgMap[defaultQueryExecModeKey]; exists {
-		rawStr := rawAny.(string) //nolint: errcheck,forcetypeassert // allow panic
-
-		defaultQueryExecMode, err = parseDefaultQueryExecMode(rawStr)
+		defaultQueryExecMode, err = parseDefaultQueryExecMode(fmt.Sprint(rawAny))
 		if err != nil {
 			return err
 		}
@@ -165,7 +349,12 @@ func parsePgxOptimizations(cfgMap map[string]any, cfg *pgxpool.Config) error {
 			return ErrDescriptionCacheCapacityMissUse
 		}
 
-		descriptionCacheCapacity := rawAny.(int32) //nolint: errcheck,forcetypeassert // allow panic
+		descriptionCacheCapacity, ok := config.Int(rawAny)
+		if !ok || descriptionCacheCapacity < 0 {
+			return fmt.Errorf(`"%s" must be a non-negative integer, got %v: %w`,
+				descriptionCacheCapacityKey, rawAny, ErrUnsupportedParam)
+		}
+
 		cfg.ConnConfig.DescriptionCacheCapacity = int(descriptionCacheCapacity)
 	}
 
@@ -174,7 +363,12 @@ func parsePgxOptimizations(cfgMap map[string]any, cfg *pgxpool.Config) error {
 			return ErrStatementCacheCapacityMissUse
 		}
 
-		statementCacheCapacity := rawAny.(int32) //nolint: errcheck,forcetypeassert // allow panic
+		statementCacheCapacity, ok := config.Int(rawAny)
+		if !ok || statementCacheCapacity < 0 {
+			return fmt.Errorf(`"%s" must be a non-negative integer, got %v: %w`,
+				statementCacheCapacityKey, rawAny, ErrUnsupportedParam)
+		}
+
 		cfg.ConnConfig.StatementCacheCapacity = int(statementCacheCapacity)
 	}
 
@@ -200,20 +394,120 @@ func parseDefaultQueryExecMode(modeStr string) (pgx.QueryExecMode, error) {
 	)
 }
 
+// Pool is pgxpool.Pool which also releases resources of its Config on Close.
+type Pool struct {
+	*pgxpool.Pool
+	config *Config
+}
+
+// ApplicationName returns application_name of the pool connections.
+func (p *Pool) ApplicationName() string {
+	return p.Config().ConnConfig.RuntimeParams[applicationNameParam]
+}
+
+// Failover returns the failover monitor, nil for a single host pool.
+func (p *Pool) Failover() *FailoverMonitor {
+	return p.config.failover
+}
+
+// TLSStats returns TLS versions and ciphers negotiated by the pool connections.
+func (p *Pool) TLSStats() *TLSStats {
+	return p.config.tlsStats
+}
+
+// Connect opens a connection outside of the pool, with the same hooks as pooled connections:
+// credentials, session settings and TLS stats.
+func (p *Pool) Connect(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := connectWith(p.config.ConnConfig, p.config.BeforeConnect)(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.AfterConnect != nil {
+		if err = p.config.AfterConnect(ctx, conn); err != nil {
+			_ = conn.Close(ctx)
+
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// connectFunc opens a connection outside of the pool.
+type connectFunc func(ctx context.Context) (*pgx.Conn, error)
+
+// connectWith runs beforeConnect on a copy of connConfig for every connection like the pool does,
+// so rotated credentials are used.
+func connectWith(connConfig *pgx.ConnConfig, beforeConnect func(context.Context, *pgx.ConnConfig) error) connectFunc {
+	return func(ctx context.Context) (*pgx.Conn, error) {
+		connConfig := connConfig.Copy()
+
+		if beforeConnect != nil {
+			if err := beforeConnect(ctx, connConfig); err != nil {
+				return nil, err
+			}
+		}
+
+		return pgx.ConnectConfig(ctx, connConfig)
+	}
+}
+
+func (p *Pool) Close() {
+	p.Pool.Close()
+	p.config.close()
+}
+
 func NewPool(
 	ctx context.Context,
 	config *stroppy.DriverConfig,
 	logger *zap.Logger,
-) (*pgxpool.Pool, error) {
+) (*Pool, error) {
 	parsedConfig, err := parseConfig(config, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	pool, err := pgxpool.NewWithConfig(ctx, parsedConfig)
+	return newPool(ctx, parsedConfig)
+}
+
+// NewReplicaPool connects to a replica at url with the pool settings of the driver config.
+// Tracers of the primary are shared, so the primary must be closed after the replica.
+func NewReplicaPool(
+	ctx context.Context,
+	primary *Pool,
+	config *stroppy.DriverConfig,
+	url string,
+	logger *zap.Logger,
+) (*Pool, error) {
+	parsedConfig, err := parseURLConfig(config, url, primary.config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPool(ctx, parsedConfig)
+}
+
+func newPool(ctx context.Context, parsedConfig *Config) (*Pool, error) {
+	pool, err := pgxpool.NewWithConfig(ctx, parsedConfig.Config)
 	if err != nil {
+		parsedConfig.close()
+
 		return nil, err
 	}
 
-	return pool, nil
+	if parsedConfig.checkConnect {
+		if err = pool.Ping(ctx); err != nil {
+			pool.Close()
+			parsedConfig.close()
+
+			return nil, err
+		}
+	}
+
+	if parsedConfig.failover != nil {
+		parsedConfig.failover.reset = pool.Reset
+	}
+
+	return &Pool{Pool: pool, config: parsedConfig}, nil
 }
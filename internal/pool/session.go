@@ -0,0 +1,204 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// session_settings are GUCs set on every pooled connection,
+// as struct or "name=value;name=value" string, values may contain commas, e.g. search_path.
+const sessionSettingsKey = "session_settings"
+
+var ErrInvalidSessionSetting = errors.New("invalid session setting")
+
+// setSessionSQL sets every setting of the name and value arrays in one round trip.
+const setSessionSQL = "SELECT set_config(name, value, false) FROM unnest($1::text[], $2::text[]) AS s(name, value)"
+
+// sessionContexts are pg_settings contexts of GUCs which can be changed with SET.
+var sessionContexts = []string{"user", "superuser"}
+
+// sessionConn is satisfied by pgx.Conn.
+type sessionConn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// sessionSettings validates GUCs against pg_settings and applies them with set_config on connect.
+// NOTE: GUCs are validated on the first connection only and set with a single statement,
+// so connections opened per transaction do not pay a round trip per setting.
+type sessionSettings struct {
+	values map[string]string
+	names  []string
+	logger *zap.Logger
+	logged sync.Once
+
+	validated atomic.Bool
+}
+
+// parseSessionSettings returns nil when "session_settings" is not set.
+func parseSessionSettings(cfgMap map[string]any, logger *zap.Logger) (*sessionSettings, error) {
+	rawAny, exists := cfgMap[sessionSettingsKey]
+	if !exists {
+		return nil, nil //nolint: nilnil // no settings
+	}
+
+	values := make(map[string]string)
+
+	switch raw := rawAny.(type) {
+	case map[string]any:
+		for name, value := range raw {
+			values[strings.ToLower(name)] = fmt.Sprint(value)
+		}
+	case string:
+		for _, pair := range strings.Split(raw, ";") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf(`"%s" of "%s" must be name=value: %w`,
+					pair, sessionSettingsKey, ErrUnsupportedParam)
+			}
+
+			values[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	default:
+		return nil, fmt.Errorf(`"%s" must be a struct or a string, got %v: %w`,
+			sessionSettingsKey, rawAny, ErrUnsupportedParam)
+	}
+
+	return &sessionSettings{
+		values: values,
+		names:  slices.Sorted(maps.Keys(values)),
+		logger: logger,
+	}, nil
+}
+
+// startupParams moves settings which must be known at connection startup to runtime params.
+func (s *sessionSettings) startupParams(params map[string]string) {
+	if value, ok := s.values[applicationNameParam]; ok {
+		params[applicationNameParam] = value
+		delete(s.values, applicationNameParam)
+		s.names = slices.DeleteFunc(s.names, func(name string) bool { return name == applicationNameParam })
+	}
+}
+
+func (s *sessionSettings) apply(ctx context.Context, conn sessionConn) error {
+	if len(s.names) == 0 {
+		return nil
+	}
+
+	if !s.validated.Load() {
+		if err := s.validate(ctx, conn); err != nil {
+			return err
+		}
+
+		s.validated.Store(true)
+	}
+
+	values := make([]string, len(s.names))
+	for i, name := range s.names {
+		values[i] = s.values[name]
+	}
+
+	if _, err := conn.Exec(ctx, setSessionSQL, s.names, values); err != nil {
+		return fmt.Errorf("set %v to %v: %w", s.names, values, err)
+	}
+
+	var logErr error
+
+	s.logged.Do(func() {
+		logErr = s.log(ctx, conn)
+	})
+
+	return logErr
+}
+
+// connect wraps connect to apply the settings on its connections, nil settings apply nothing.
+func (s *sessionSettings) connect(connect connectFunc) connectFunc {
+	if s == nil {
+		return connect
+	}
+
+	return func(ctx context.Context) (*pgx.Conn, error) {
+		conn, err := connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = s.apply(ctx, conn); err != nil {
+			_ = conn.Close(ctx)
+
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// validate rejects unknown GUCs and GUCs which can not be set per session.
+// Custom "prefix.name" GUCs missing in pg_settings are allowed.
+func (s *sessionSettings) validate(ctx context.Context, conn sessionConn) error {
+	rows, err := conn.Query(ctx, "SELECT name, context FROM pg_settings WHERE name = ANY($1)", s.names)
+	if err != nil {
+		return err
+	}
+
+	contexts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([2]string, error) {
+		var nameContext [2]string
+
+		return nameContext, row.Scan(&nameContext[0], &nameContext[1])
+	})
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]string, len(contexts))
+	for _, nameContext := range contexts {
+		known[nameContext[0]] = nameContext[1]
+	}
+
+	for _, name := range s.names {
+		settingContext, ok := known[name]
+
+		switch {
+		case !ok && !strings.Contains(name, "."):
+			return fmt.Errorf(`"%s" is not found in pg_settings: %w`, name, ErrInvalidSessionSetting)
+		case ok && !slices.Contains(sessionContexts, settingContext):
+			return fmt.Errorf(`"%s" has "%s" context and can not be set per session: %w`,
+				name, settingContext, ErrInvalidSessionSetting)
+		}
+	}
+
+	return nil
+}
+
+// log reports effective values of the settings once per pool.
+func (s *sessionSettings) log(ctx context.Context, conn sessionConn) error {
+	fields := make([]zap.Field, 0, len(s.names))
+
+	for _, name := range s.names {
+		var value string
+		if err := conn.QueryRow(ctx, "SELECT current_setting($1)", name).Scan(&value); err != nil {
+			return err
+		}
+
+		fields = append(fields, zap.String(name, value))
+	}
+
+	s.logger.Info("session settings applied", fields...)
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+const (
+	slowQueryThresholdKey = "slow_query_threshold"
+	slowQueryLogKey       = "slow_query_log"
+	slowQueryExplainKey   = "slow_query_explain"
+	// slow_query_explain_analyze runs read-only statements once more with EXPLAIN ANALYZE,
+	// it is opt-in since functions called by the statement run again, in a READ ONLY transaction rolled back.
+	slowQueryExplainAnalyzeKey = "slow_query_explain_analyze"
+)
+
+const (
+	defaultSlowQueryLog   = "slow_queries.jsonl"
+	slowQueryFileMode     = 0o644
+	slowQueryQueueSize    = 128
+	slowQueryExplainLimit = 30 * time.Second
+)
+
+// SlowQuery is a line of the slow query log.
+type SlowQuery struct {
+	Time         time.Time       `json:"time"`
+	Query        string          `json:"query,omitempty"`
+	Statement    string          `json:"statement,omitempty"`
+	SQL          string          `json:"sql"`
+	DurationUs   int64           `json:"duration_us"`
+	RowsAffected int64           `json:"rows_affected"`
+	SQLState     string          `json:"sqlstate,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Explain      string          `json:"explain,omitempty"`
+	Plan         json.RawMessage `json:"plan,omitempty"`
+	ExplainError string          `json:"explain_error,omitempty"`
+}
+
+type slowQueryTask struct {
+	entry     *SlowQuery
+	args      []any
+	explainer *slowQueryExplainer
+}
+
+type slowQueryStartKey struct{}
+
+type slowQueryStart struct {
+	at        time.Time
+	statement string
+	sql       string
+	args      []any
+}
+
+// slowQueryLog writes queries slower than threshold to a JSON-lines file, one file for the primary and replicas.
+// With explain enabled the plan is captured on a separate connection by a background worker,
+// so workers of the benchmark are not delayed. Read-only statements are explained with ANALYZE on opt-in.
+type slowQueryLog struct {
+	threshold time.Duration
+	explain   bool
+	analyze   bool
+	logger    *zap.Logger
+
+	file    *os.File
+	tasks   chan slowQueryTask
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	mu         sync.Mutex
+	explainers []*slowQueryExplainer
+}
+
+// slowQueryTracer sends slow queries of a pool to the log, they are explained on a connection to the same server.
+type slowQueryTracer struct {
+	log       *slowQueryLog
+	explainer *slowQueryExplainer
+	// statements maps names of prepared statements to their SQL, queries run by name are logged with the SQL.
+	statements sync.Map
+}
+
+// slowQueryExplainer holds the explain connection to a server, only the log worker uses it.
+type slowQueryExplainer struct {
+	connect connectFunc
+	conn    *pgx.Conn
+}
+
+var (
+	_ pgx.QueryTracer   = (*slowQueryTracer)(nil)
+	_ pgx.PrepareTracer = (*slowQueryTracer)(nil)
+)
+
+// newSlowQueryLog returns nil log when "slow_query_threshold" is not set.
+func newSlowQueryLog(cfgMap map[string]any, logger *zap.Logger) (*slowQueryLog, func(), error) {
+	rawAny, exists := cfgMap[slowQueryThresholdKey]
+	if !exists {
+		return nil, nil, nil
+	}
+
+	threshold, ok := config.Duration(rawAny)
+	if !ok {
+		return nil, nil, fmt.Errorf(`"%s" must be a duration string, got %v: %w`,
+			slowQueryThresholdKey, rawAny, ErrUnsupportedParam)
+	}
+
+	path := defaultSlowQueryLog
+	if rawAny, exists := cfgMap[slowQueryLogKey]; exists {
+		if path, ok = config.String(rawAny); !ok {
+			return nil, nil, fmt.Errorf(`"%s" must be a string, got %v: %w`,
+				slowQueryLogKey, rawAny, ErrUnsupportedParam)
+		}
+	}
+
+	explain := false
+	if rawAny, exists := cfgMap[slowQueryExplainKey]; exists {
+		if explain, ok = config.Bool(rawAny); !ok {
+			return nil, nil, fmt.Errorf(`"%s" must be a bool, got %v: %w`,
+				slowQueryExplainKey, rawAny, ErrUnsupportedParam)
+		}
+	}
+
+	analyze := false
+	if rawAny, exists := cfgMap[slowQueryExplainAnalyzeKey]; exists {
+		if analyze, ok = config.Bool(rawAny); !ok {
+			return nil, nil, fmt.Errorf(`"%s" must be a bool, got %v: %w`,
+				slowQueryExplainAnalyzeKey, rawAny, ErrUnsupportedParam)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, slowQueryFileMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log := &slowQueryLog{
+		threshold: threshold,
+		explain:   explain,
+		analyze:   analyze,
+		logger:    logger,
+		file:      file,
+		tasks:     make(chan slowQueryTask, slowQueryQueueSize),
+		done:      make(chan struct{}),
+	}
+
+	go log.run()
+
+	return log, log.close, nil
+}
+
+// tracer returns the tracer of a pool, connect opens its explain connections which must not have tracers set.
+func (l *slowQueryLog) tracer(connect connectFunc) *slowQueryTracer {
+	explainer := &slowQueryExplainer{connect: connect}
+
+	l.mu.Lock()
+	l.explainers = append(l.explainers, explainer)
+	l.mu.Unlock()
+
+	return &slowQueryTracer{log: l, explainer: explainer}
+}
+
+func (t *slowQueryTracer) TracePrepareStart(
+	ctx context.Context,
+	_ *pgx.Conn,
+	data pgx.TracePrepareStartData,
+) context.Context {
+	if data.Name != "" {
+		t.statements.Store(data.Name, data.SQL)
+	}
+
+	return ctx
+}
+
+func (t *slowQueryTracer) TracePrepareEnd(context.Context, *pgx.Conn, pgx.TracePrepareEndData) {}
+
+func (t *slowQueryTracer) TraceQueryStart(
+	ctx context.Context,
+	_ *pgx.Conn,
+	data pgx.TraceQueryStartData,
+) context.Context {
+	start := &slowQueryStart{
+		at:   time.Now(),
+		sql:  data.SQL,
+		args: data.Args,
+	}
+
+	// NOTE: pgx runs prepared statements by name, so the SQL is the name for them.
+	if sql, ok := t.statements.Load(data.SQL); ok {
+		start.statement, start.sql = data.SQL, sql.(string) //nolint: forcetypeassert // only SQL is stored
+	}
+
+	return context.WithValue(ctx, slowQueryStartKey{}, start)
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(slowQueryStartKey{}).(*slowQueryStart)
+	if !ok {
+		return
+	}
+
+	duration := time.Since(start.at)
+	if duration < t.log.threshold {
+		return
+	}
+
+	entry := &SlowQuery{
+		Time:         start.at,
+		Query:        QueryName(ctx),
+		Statement:    start.statement,
+		SQL:          start.sql,
+		DurationUs:   duration.Microseconds(),
+		RowsAffected: data.CommandTag.RowsAffected(),
+	}
+
+	if data.Err != nil {
+		entry.Error = data.Err.Error()
+
+		var pgErr *pgconn.PgError
+		if errors.As(data.Err, &pgErr) {
+			entry.SQLState = pgErr.Code
+		}
+	}
+
+	select {
+	case t.log.tasks <- slowQueryTask{entry: entry, args: start.args, explainer: t.explainer}:
+	default:
+		t.log.dropped.Add(1)
+	}
+}
+
+func (l *slowQueryLog) run() {
+	defer close(l.done)
+
+	encoder := json.NewEncoder(l.file)
+
+	for task := range l.tasks {
+		if l.explain {
+			task.explainer.explainQuery(task.entry, task.args, l.analyze)
+		}
+
+		if err := encoder.Encode(task.entry); err != nil {
+			l.logger.Error("failed to write slow query", zap.Error(err))
+		}
+	}
+}
+
+const (
+	explainAnalyze = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON)"
+	explainPlain   = "EXPLAIN (FORMAT JSON)"
+)
+
+// explainPrefix returns EXPLAIN to run for sql, ANALYZE is used only when enabled and only for read-only statements.
+// False is returned for statements which can not be explained.
+func explainPrefix(sql string, analyze bool) (string, bool) {
+	if analyze && ReadOnlyStatement(sql) {
+		return explainAnalyze, true
+	}
+
+	switch kind, _ := statementKind(sql); kind {
+	case "SELECT", "VALUES", "TABLE", "WITH", "INSERT", "UPDATE", "DELETE", "MERGE":
+		return explainPlain, true
+	default:
+		return "", false
+	}
+}
+
+func (e *slowQueryExplainer) explainQuery(entry *SlowQuery, args []any, analyze bool) {
+	prefix, ok := explainPrefix(entry.SQL, analyze)
+	if !ok {
+		return
+	}
+
+	entry.Explain = prefix
+
+	ctx, cancel := context.WithTimeout(context.Background(), slowQueryExplainLimit)
+	defer cancel()
+
+	if e.conn == nil || e.conn.IsClosed() {
+		conn, err := e.connect(ctx)
+		if err != nil {
+			entry.ExplainError = err.Error()
+
+			return
+		}
+
+		e.conn = conn
+	}
+
+	var querier interface {
+		QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	} = e.conn
+
+	// NOTE: ANALYZE runs the statement, the server rejects its writes in a READ ONLY transaction.
+	if prefix == explainAnalyze {
+		tx, err := e.conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+		if err != nil {
+			entry.ExplainError = err.Error()
+
+			return
+		}
+		defer tx.Rollback(ctx) //nolint: errcheck // nothing is written
+
+		querier = tx
+	}
+
+	var plan []byte
+	if err := querier.QueryRow(ctx, prefix+" "+entry.SQL, args...).Scan(&plan); err != nil {
+		entry.ExplainError = err.Error()
+
+		return
+	}
+
+	entry.Plan = plan
+}
+
+// close must be called after every pool of the log is closed.
+func (l *slowQueryLog) close() {
+	close(l.tasks)
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, explainer := range l.explainers {
+		if explainer.conn != nil {
+			_ = explainer.conn.Close(context.Background())
+		}
+	}
+
+	if dropped := l.dropped.Load(); dropped > 0 {
+		l.logger.Warn("slow queries dropped, explain queue is full", zap.Uint64("dropped", dropped))
+	}
+
+	_ = l.file.Close()
+}
@@ -0,0 +1,142 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+)
+
+func TestExplainPrefix(t *testing.T) {
+	tests := []struct {
+		sql     string
+		analyze bool
+		prefix  string
+	}{
+		{"SELECT 1", true, explainAnalyze},
+		{"SELECT 1", false, explainPlain},
+		{"  -- comment\n/* block */ select * from t", true, explainAnalyze},
+		{"VALUES (1)", true, explainAnalyze},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true, explainAnalyze},
+		{"WITH x AS (DELETE FROM t RETURNING *) SELECT * FROM x", true, explainPlain},
+		{"SELECT my_writing_fn()", true, explainPlain},
+		{"INSERT INTO t VALUES ($1)", true, explainPlain},
+		{"update t set a = 1", false, explainPlain},
+		{"BEGIN", true, ""},
+		{"COPY t FROM STDIN", false, ""},
+		{"stmt_name_0badf00d", true, ""},
+	}
+
+	for _, tt := range tests {
+		prefix, ok := explainPrefix(tt.sql, tt.analyze)
+		require.Equal(t, tt.prefix, prefix, tt.sql)
+		require.Equal(t, tt.prefix != "", ok, tt.sql)
+	}
+}
+
+func TestNewSlowQueryLog(t *testing.T) {
+	log, closer, err := newSlowQueryLog(map[string]any{}, logger.Global())
+	require.NoError(t, err)
+	require.Nil(t, log)
+	require.Nil(t, closer)
+
+	_, _, err = newSlowQueryLog(map[string]any{slowQueryThresholdKey: int32(1)}, logger.Global())
+	require.ErrorIs(t, err, ErrUnsupportedParam)
+
+	_, _, err = newSlowQueryLog(map[string]any{
+		slowQueryThresholdKey: "1s",
+		slowQueryExplainKey:   "yes",
+	}, logger.Global())
+	require.ErrorIs(t, err, ErrUnsupportedParam)
+
+	_, _, err = newSlowQueryLog(map[string]any{
+		slowQueryThresholdKey:      "1s",
+		slowQueryExplainAnalyzeKey: "yes",
+	}, logger.Global())
+	require.ErrorIs(t, err, ErrUnsupportedParam)
+}
+
+func TestSlowQueryTracer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.jsonl")
+
+	connCfg, err := pgx.ParseConfig("postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	require.NoError(t, err)
+
+	var passwords []string
+
+	connect := connectWith(connCfg, func(_ context.Context, connConfig *pgx.ConnConfig) error {
+		connConfig.Password = "rotated"
+		passwords = append(passwords, connConfig.Password)
+
+		return nil
+	})
+
+	log, closer, err := newSlowQueryLog(map[string]any{
+		slowQueryThresholdKey:      "0s",
+		slowQueryLogKey:            path,
+		slowQueryExplainKey:        true,
+		slowQueryExplainAnalyzeKey: true,
+	}, logger.Global())
+	require.NoError(t, err)
+
+	tracer := log.tracer(connect)
+
+	ctx := WithQueryName(context.Background(), "select_item")
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT * FROM t WHERE id = $1", Args: []any{1}})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "COMMIT"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "40001"}})
+
+	ctx = tracer.TracePrepareStart(context.Background(), nil, pgx.TracePrepareStartData{
+		Name: "select_item_0badf00d",
+		SQL:  "SELECT * FROM t WHERE id = $1",
+	})
+	tracer.TracePrepareEnd(ctx, nil, pgx.TracePrepareEndData{})
+
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "select_item_0badf00d", Args: []any{1}})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	closer()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	var entries []SlowQuery
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry SlowQuery
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "select_item", entries[0].Query)
+	require.Equal(t, int64(1), entries[0].RowsAffected)
+	require.Equal(t, explainAnalyze, entries[0].Explain)
+	require.NotEmpty(t, entries[0].ExplainError)
+	require.Equal(t, "rotated", passwords[0], "explain connection runs BeforeConnect")
+	require.Empty(t, connCfg.Password, "BeforeConnect changes a copy of the config")
+
+	require.Equal(t, "COMMIT", entries[1].SQL)
+	require.Equal(t, "40001", entries[1].SQLState)
+	require.Empty(t, entries[1].Explain)
+
+	require.Equal(t, "select_item_0badf00d", entries[2].Statement)
+	require.Equal(t, "SELECT * FROM t WHERE id = $1", entries[2].SQL, "prepared statement is logged with its SQL")
+	require.Equal(t, explainAnalyze, entries[2].Explain)
+	require.Equal(t, []string{"rotated", "rotated"}, passwords)
+}
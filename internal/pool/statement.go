@@ -0,0 +1,68 @@
+package pool
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	sqlLeadingCommentsRe = regexp.MustCompile(`^(?s:\s+|--[^\n]*\n?|/\*.*?\*/)*`)
+	sqlFirstWordRe       = regexp.MustCompile(`^\w+`)
+	sqlModifyingRe       = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE)\b`)
+	// sqlSideEffectsRe matches reads which still lock rows, create tables or advance sequences.
+	sqlSideEffectsRe = regexp.MustCompile(`(?i)\bFOR\s+(NO\s+KEY\s+UPDATE|UPDATE|KEY\s+SHARE|SHARE)\b|\bINTO\b`)
+	// sqlCallRe matches a name followed by "(", a function call or a keyword taking a parenthesized list.
+	sqlCallRe = regexp.MustCompile(`("(?:[^"]|"")*"|\b[A-Za-z_][A-Za-z0-9_$]*)\s*\(`)
+)
+
+// sqlReadOnlyCalls are keywords and built-in functions which do not write, any other call may write
+// (e.g. a user function, pg_advisory_lock or nextval), so the statement is not read-only.
+var sqlReadOnlyCalls = map[string]struct{}{
+	// keywords
+	"select": {}, "values": {}, "in": {}, "exists": {}, "any": {}, "all": {}, "some": {}, "as": {},
+	"from": {}, "join": {}, "on": {}, "using": {}, "where": {}, "and": {}, "or": {}, "not": {},
+	"cast": {}, "over": {}, "filter": {}, "within": {}, "lateral": {}, "row": {}, "array": {},
+	"when": {}, "then": {}, "else": {}, "by": {}, "having": {}, "union": {}, "intersect": {}, "except": {},
+	// aggregates and scalar functions
+	"count": {}, "sum": {}, "avg": {}, "min": {}, "max": {}, "coalesce": {}, "nullif": {},
+	"greatest": {}, "least": {}, "abs": {}, "round": {}, "floor": {}, "ceil": {},
+	"lower": {}, "upper": {}, "length": {}, "substring": {}, "substr": {}, "extract": {},
+	"date_trunc": {}, "now": {}, "array_agg": {}, "string_agg": {}, "bool_and": {}, "bool_or": {},
+	// type modifiers
+	"numeric": {}, "decimal": {}, "varchar": {}, "char": {}, "character": {}, "timestamp": {}, "interval": {},
+}
+
+// statementKind returns the first keyword of sql in upper case, skipping leading comments.
+func statementKind(sql string) (string, string) {
+	body := sql[len(sqlLeadingCommentsRe.FindString(sql)):]
+
+	return strings.ToUpper(sqlFirstWordRe.FindString(body)), body
+}
+
+// ReadOnlyStatement reports whether sql only reads data and may run on a standby:
+// SELECT, VALUES, TABLE or WITH without data-modifying statements, locking clauses,
+// SELECT INTO or calls of functions other than known read-only built-ins.
+// The check is lexical, so unsure cases are reported as writes.
+func ReadOnlyStatement(sql string) bool {
+	kind, body := statementKind(sql)
+
+	switch kind {
+	case "SELECT", "VALUES", "TABLE":
+		return !sqlSideEffectsRe.MatchString(body) && !callsFunctions(body)
+	case "WITH":
+		return !sqlModifyingRe.MatchString(body) && !sqlSideEffectsRe.MatchString(body) && !callsFunctions(body)
+	default:
+		return false
+	}
+}
+
+// callsFunctions reports whether sql calls a function missing in sqlReadOnlyCalls, quoted names always count.
+func callsFunctions(sql string) bool {
+	for _, match := range sqlCallRe.FindAllStringSubmatch(sql, -1) {
+		if _, ok := sqlReadOnlyCalls[strings.ToLower(match[1])]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
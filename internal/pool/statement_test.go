@@ -0,0 +1,39 @@
+package pool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyStatement(t *testing.T) {
+	tests := []struct {
+		sql      string
+		readOnly bool
+	}{
+		{"SELECT 1", true},
+		{"  -- comment\n/* block */ select * from t where id = $1", true},
+		{"VALUES (1)", true},
+		{"TABLE t", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"WITH x AS (DELETE FROM t RETURNING *) SELECT * FROM x", false},
+		{"SELECT * FROM t FOR UPDATE", false},
+		{"select * from t for no key update skip locked", false},
+		{"SELECT * FROM t FOR SHARE", false},
+		{"SELECT * INTO t2 FROM t", false},
+		{"SELECT nextval('seq')", false},
+		{"SELECT count(*), max(v) FROM t WHERE id IN (SELECT id FROM u) AND v > coalesce($1, 0)", true},
+		{"SELECT my_writing_fn()", false},
+		{"SELECT pg_advisory_lock(1)", false},
+		{"SELECT * FROM app.report(1)", false},
+		{`SELECT "Report"()`, false},
+		{"WITH x AS (SELECT audit($1)) SELECT * FROM x", false},
+		{"INSERT INTO t VALUES ($1)", false},
+		{"update t set a = 1", false},
+		{"BEGIN", false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.readOnly, ReadOnlyStatement(tt.sql), tt.sql)
+	}
+}
@@ -0,0 +1,370 @@
+package pool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
+)
+
+// TLS keys replace TLS settings of the URL, settings not given in db_specific are taken from the URL.
+// tls_ca, tls_cert and tls_key are file paths or inline PEM.
+const (
+	tlsModeKey       = "tls_mode"
+	tlsCAKey         = "tls_ca"
+	tlsCertKey       = "tls_cert"
+	tlsKeyKey        = "tls_key"
+	tlsServerNameKey = "tls_server_name"
+	tlsMinVersionKey = "tls_min_version"
+)
+
+// TLSMode has the semantics of libpq sslmode.
+type TLSMode string
+
+const (
+	TLSModeDisable    TLSMode = "disable"
+	TLSModeAllow      TLSMode = "allow"
+	TLSModePrefer     TLSMode = "prefer"
+	TLSModeRequire    TLSMode = "require"
+	TLSModeVerifyCA   TLSMode = "verify-ca"
+	TLSModeVerifyFull TLSMode = "verify-full"
+)
+
+const pemPrefix = "-----BEGIN"
+
+var (
+	supportedTLSModes = []TLSMode{
+		TLSModeDisable, TLSModeAllow, TLSModePrefer, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull,
+	}
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+type tlsOptions struct {
+	// mode is empty when the URL sslmode is kept.
+	mode       TLSMode
+	roots      *x509.CertPool
+	certs      []tls.Certificate
+	serverName string
+	minVersion uint16
+}
+
+// parseTLS returns nil when no TLS key is set.
+func parseTLS(cfgMap map[string]any) (*tlsOptions, error) {
+	opts := &tlsOptions{}
+	set := false
+
+	str := func(key string) (string, error) {
+		rawAny, exists := cfgMap[key]
+		if !exists {
+			return "", nil
+		}
+
+		set = true
+
+		value, ok := config.String(rawAny)
+		if !ok || value == "" {
+			return "", fmt.Errorf(`"%s" must be a non-empty string, got %v: %w`, key, rawAny, ErrUnsupportedParam)
+		}
+
+		return value, nil
+	}
+
+	mode, err := str(tlsModeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != "" {
+		opts.mode = TLSMode(mode)
+		if !slices.Contains(supportedTLSModes, opts.mode) {
+			return nil, fmt.Errorf(`"%s" invalid for "%s" key; supported values are %v: %w`,
+				mode, tlsModeKey, supportedTLSModes, ErrUnsupportedParam)
+		}
+	}
+
+	ca, err := str(tlsCAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if ca != "" {
+		caPEM, err := readPEM(tlsCAKey, ca)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.roots = x509.NewCertPool()
+		if !opts.roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf(`"%s" has no PEM certificates: %w`, tlsCAKey, ErrUnsupportedParam)
+		}
+	}
+
+	cert, err := str(tlsCertKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := str(tlsKeyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if (cert == "") != (key == "") {
+		return nil, fmt.Errorf(`both "%s" and "%s" are required: %w`, tlsCertKey, tlsKeyKey, ErrUnsupportedParam)
+	}
+
+	if cert != "" {
+		certPEM, err := readPEM(tlsCertKey, cert)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPEM, err := readPEM(tlsKeyKey, key)
+		if err != nil {
+			return nil, err
+		}
+
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf(`"%s" and "%s": %w`, tlsCertKey, tlsKeyKey, err)
+		}
+
+		opts.certs = []tls.Certificate{pair}
+	}
+
+	if opts.serverName, err = str(tlsServerNameKey); err != nil {
+		return nil, err
+	}
+
+	minVersion, err := str(tlsMinVersionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if minVersion != "" {
+		var ok bool
+		if opts.minVersion, ok = tlsVersions[strings.TrimPrefix(strings.ToLower(minVersion), "tls")]; !ok {
+			return nil, fmt.Errorf(`"%s" invalid for "%s" key; supported values are %v: %w`,
+				minVersion, tlsMinVersionKey, []string{"1.0", "1.1", "1.2", "1.3"}, ErrUnsupportedParam)
+		}
+	}
+
+	if !set {
+		return nil, nil //nolint: nilnil // TLS settings of the URL are kept
+	}
+
+	return opts, nil
+}
+
+// readPEM returns inline PEM as is and reads anything else as a file path.
+func readPEM(key, value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), pemPrefix) {
+		return []byte(value), nil
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf(`"%s": %w`, key, err)
+	}
+
+	return data, nil
+}
+
+// tlsHost is a server of the URL, hosts repeat in fallbacks once per sslmode attempt.
+type tlsHost struct {
+	host string
+	port uint16
+}
+
+// apply rebuilds TLS configs of every host of the URL like pgconn.ParseConfig does for sslmode.
+func (o *tlsOptions) apply(connConfig *pgconn.Config) {
+	if o == nil {
+		return
+	}
+
+	var (
+		hosts []tlsHost
+		base  *tls.Config
+	)
+
+	attempts := append([]*pgconn.FallbackConfig{{
+		Host:      connConfig.Host,
+		Port:      connConfig.Port,
+		TLSConfig: connConfig.TLSConfig,
+	}}, connConfig.Fallbacks...)
+
+	for _, attempt := range attempts {
+		host := tlsHost{host: attempt.Host, port: attempt.Port}
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+
+		if base == nil && attempt.TLSConfig != nil {
+			base = attempt.TLSConfig
+		}
+	}
+
+	mode := o.mode
+	if mode == "" {
+		mode = urlTLSMode(attempts)
+	}
+
+	// NOTE: like pgx, direct negotiation has no plaintext attempt.
+	if connConfig.SSLNegotiation == "direct" && mode == TLSModePrefer {
+		mode = TLSModeRequire
+	}
+
+	roots, certs := o.roots, o.certs
+	if base != nil {
+		if roots == nil {
+			roots = base.RootCAs
+		}
+
+		if certs == nil {
+			certs = base.Certificates
+		}
+	}
+
+	var rebuilt []*pgconn.FallbackConfig
+
+	for _, host := range hosts {
+		for _, tlsConfig := range o.configs(mode, host.host, roots, certs, connConfig.SSLNegotiation) {
+			rebuilt = append(rebuilt, &pgconn.FallbackConfig{Host: host.host, Port: host.port, TLSConfig: tlsConfig})
+		}
+	}
+
+	connConfig.Host = rebuilt[0].Host
+	connConfig.Port = rebuilt[0].Port
+	connConfig.TLSConfig = rebuilt[0].TLSConfig
+	connConfig.Fallbacks = rebuilt[1:]
+}
+
+// urlTLSMode infers sslmode of the URL from the TLS configs pgconn built for the first host.
+func urlTLSMode(attempts []*pgconn.FallbackConfig) TLSMode {
+	var configs []*tls.Config
+
+	for _, attempt := range attempts {
+		if attempt.Host != attempts[0].Host || attempt.Port != attempts[0].Port {
+			break
+		}
+
+		configs = append(configs, attempt.TLSConfig)
+	}
+
+	switch {
+	case len(configs) == 2 && configs[0] == nil: //nolint: mnd // plaintext then TLS
+		return TLSModeAllow
+	case len(configs) == 2: //nolint: mnd // TLS then plaintext
+		return TLSModePrefer
+	case configs[0] == nil:
+		return TLSModeDisable
+	case !configs[0].InsecureSkipVerify:
+		return TLSModeVerifyFull
+	case configs[0].VerifyPeerCertificate != nil:
+		return TLSModeVerifyCA
+	default:
+		return TLSModeRequire
+	}
+}
+
+// configs returns TLS configs in the order of connection attempts, nil is a plaintext attempt.
+func (o *tlsOptions) configs(
+	mode TLSMode,
+	host string,
+	roots *x509.CertPool,
+	certs []tls.Certificate,
+	sslNegotiation string,
+) []*tls.Config {
+	// NOTE: TLS is ignored for Unix domain sockets like libpq does.
+	if network, _ := pgconn.NetworkAddress(host, 0); network == "unix" || mode == TLSModeDisable {
+		return []*tls.Config{nil}
+	}
+
+	tlsConfig := &tls.Config{ //nolint: gosec // min version defaults to the Go one unless set
+		Certificates: certs,
+		MinVersion:   o.minVersion,
+		ServerName:   o.serverName,
+	}
+
+	if tlsConfig.ServerName == "" && net.ParseIP(host) == nil {
+		tlsConfig.ServerName = host
+	}
+
+	if sslNegotiation == "direct" {
+		tlsConfig.NextProtos = []string{"postgresql"}
+	}
+
+	switch mode {
+	case TLSModeVerifyFull:
+		tlsConfig.RootCAs = roots
+
+		// NOTE: like pgconn, IP hosts are verified by ServerName too, crypto/tls refuses to verify without it.
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+	case TLSModeVerifyCA:
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChain(roots)
+	case TLSModeRequire:
+		tlsConfig.InsecureSkipVerify = true
+
+		// NOTE: like libpq, require with a root CA verifies the chain.
+		if roots != nil {
+			tlsConfig.VerifyPeerCertificate = verifyChain(roots)
+		}
+	default:
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	switch mode {
+	case TLSModeAllow:
+		return []*tls.Config{nil, tlsConfig}
+	case TLSModePrefer:
+		return []*tls.Config{tlsConfig, nil}
+	default:
+		return []*tls.Config{tlsConfig}
+	}
+}
+
+// verifyChain checks the server certificate chain without the host name, as verify-ca does.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+
+		var leaf *x509.Certificate
+
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse certificate from server: %w", err)
+			}
+
+			if i == 0 {
+				leaf = cert
+			} else {
+				opts.Intermediates.AddCert(cert)
+			}
+		}
+
+		_, err := leaf.Verify(opts)
+
+		return err
+	}
+}
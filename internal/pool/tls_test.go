@@ -0,0 +1,270 @@
+package pool
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/logger"
+)
+
+// selfSigned returns PEM encoded certificate and key valid for localhost and 127.0.0.1.
+func selfSigned(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// handshake runs a TLS handshake of the client config against a server with the certificate.
+func handshake(t *testing.T, certPEM, keyPEM []byte, clientConfig *tls.Config) {
+	t.Helper()
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12})
+
+	go func() { _ = server.Handshake() }()
+
+	require.NoError(t, tls.Client(clientConn, clientConfig).Handshake())
+}
+
+func TestParseTLS(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	keyPath := filepath.Join(t.TempDir(), "client.key")
+	require.NoError(t, os.WriteFile(keyPath, keyPEM, 0o600))
+
+	opts, err := parseTLS(map[string]any{})
+	require.NoError(t, err)
+	require.Nil(t, opts)
+
+	opts, err = parseTLS(map[string]any{
+		tlsModeKey:       "verify-full",
+		tlsCAKey:         string(certPEM),
+		tlsCertKey:       string(certPEM),
+		tlsKeyKey:        keyPath,
+		tlsServerNameKey: "db.internal",
+		tlsMinVersionKey: "1.3",
+	})
+	require.NoError(t, err)
+	require.Equal(t, TLSModeVerifyFull, opts.mode)
+	require.NotNil(t, opts.roots)
+	require.Len(t, opts.certs, 1)
+	require.Equal(t, "db.internal", opts.serverName)
+	require.Equal(t, uint16(tls.VersionTLS13), opts.minVersion)
+
+	opts, err = parseTLS(map[string]any{tlsMinVersionKey: "TLS1.2"})
+	require.NoError(t, err)
+	require.Empty(t, opts.mode)
+	require.Equal(t, uint16(tls.VersionTLS12), opts.minVersion)
+
+	for name, cfgMap := range map[string]map[string]any{
+		"unknown mode":    {tlsModeKey: "always"},
+		"empty mode":      {tlsModeKey: ""},
+		"cert only":       {tlsCertKey: string(certPEM)},
+		"not a PEM":       {tlsCAKey: "-----BEGIN nothing"},
+		"missing file":    {tlsCAKey: filepath.Join(t.TempDir(), "missing.pem")},
+		"unknown version": {tlsMinVersionKey: "1.4"},
+		"not a string":    {tlsServerNameKey: true},
+	} {
+		_, err = parseTLS(cfgMap)
+		require.Error(t, err, name)
+	}
+
+	_, err = parseTLS(map[string]any{tlsCertKey: string(certPEM), tlsKeyKey: string(certPEM)})
+	require.Error(t, err)
+}
+
+func TestTLSOptions_Apply(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	opts, err := parseTLS(map[string]any{tlsModeKey: "prefer", tlsCAKey: string(certPEM)})
+	require.NoError(t, err)
+
+	connConfig, err := pgconn.ParseConfig("postgres://u@h1:5432,10.0.0.2:5433/db?sslmode=disable")
+	require.NoError(t, err)
+
+	opts.apply(connConfig)
+
+	require.Equal(t, "h1", connConfig.Host)
+	require.NotNil(t, connConfig.TLSConfig)
+	require.Equal(t, "h1", connConfig.TLSConfig.ServerName)
+	require.True(t, connConfig.TLSConfig.InsecureSkipVerify)
+	require.Len(t, connConfig.Fallbacks, 3)
+	require.Nil(t, connConfig.Fallbacks[0].TLSConfig)
+	require.Equal(t, "10.0.0.2", connConfig.Fallbacks[1].Host)
+	require.Equal(t, uint16(5433), connConfig.Fallbacks[1].Port)
+	require.Empty(t, connConfig.Fallbacks[1].TLSConfig.ServerName, "no SNI for IP addresses")
+	require.Nil(t, connConfig.Fallbacks[2].TLSConfig)
+	require.True(t, multiHost(connConfig))
+
+	opts, err = parseTLS(map[string]any{tlsModeKey: "verify-full", tlsCAKey: string(certPEM)})
+	require.NoError(t, err)
+
+	connConfig, err = pgconn.ParseConfig("postgres://u@10.0.0.2:5432/db")
+	require.NoError(t, err)
+
+	opts.apply(connConfig)
+
+	require.Empty(t, connConfig.Fallbacks)
+	require.False(t, connConfig.TLSConfig.InsecureSkipVerify)
+	require.Equal(t, "10.0.0.2", connConfig.TLSConfig.ServerName, "verify-full checks the IP address")
+
+	connConfig, err = pgconn.ParseConfig("postgres://u@127.0.0.1:5432/db")
+	require.NoError(t, err)
+
+	opts.apply(connConfig)
+	handshake(t, certPEM, keyPEM, connConfig.TLSConfig)
+
+	opts, err = parseTLS(map[string]any{tlsModeKey: "verify-ca", tlsServerNameKey: "db.internal"})
+	require.NoError(t, err)
+
+	connConfig, err = pgconn.ParseConfig("postgres://u@h1/db")
+	require.NoError(t, err)
+
+	opts.apply(connConfig)
+
+	require.Empty(t, connConfig.Fallbacks)
+	require.Equal(t, "db.internal", connConfig.TLSConfig.ServerName)
+	require.NotNil(t, connConfig.TLSConfig.VerifyPeerCertificate)
+
+	opts, err = parseTLS(map[string]any{tlsModeKey: "require"})
+	require.NoError(t, err)
+
+	connConfig, err = pgconn.ParseConfig("host=/tmp dbname=db")
+	require.NoError(t, err)
+
+	opts.apply(connConfig)
+
+	require.Nil(t, connConfig.TLSConfig, "TLS is ignored for unix sockets")
+}
+
+func TestTLSOptions_ApplyKeepsURLMode(t *testing.T) {
+	for _, mode := range supportedTLSModes {
+		opts, err := parseTLS(map[string]any{tlsMinVersionKey: "1.2"})
+		require.NoError(t, err)
+
+		connConfig, err := pgconn.ParseConfig("postgres://u@localhost/db?sslmode=" + string(mode))
+		require.NoError(t, err)
+
+		attempts := append([]*pgconn.FallbackConfig{{
+			Host: connConfig.Host, Port: connConfig.Port, TLSConfig: connConfig.TLSConfig,
+		}}, connConfig.Fallbacks...)
+		require.Equal(t, mode, urlTLSMode(attempts))
+
+		opts.apply(connConfig)
+
+		attempts = append([]*pgconn.FallbackConfig{{
+			Host: connConfig.Host, Port: connConfig.Port, TLSConfig: connConfig.TLSConfig,
+		}}, connConfig.Fallbacks...)
+		require.Equal(t, mode, urlTLSMode(attempts))
+
+		for _, attempt := range attempts {
+			if attempt.TLSConfig != nil {
+				require.Equal(t, uint16(tls.VersionTLS12), attempt.TLSConfig.MinVersion)
+			}
+		}
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	certPEM, _ := selfSigned(t)
+	otherPEM, _ := selfSigned(t)
+
+	block, _ := pem.Decode(certPEM)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	require.NoError(t, verifyChain(roots)([][]byte{block.Bytes}, nil))
+
+	others := x509.NewCertPool()
+	require.True(t, others.AppendCertsFromPEM(otherPEM))
+	require.Error(t, verifyChain(others)([][]byte{block.Bytes}, nil))
+	require.Error(t, verifyChain(roots)(nil, nil))
+}
+
+func TestTLSStats(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	dial := wrapDial(func(context.Context, string, string) (net.Conn, error) {
+		return clientConn, nil
+	})
+
+	dialed, err := dial(context.Background(), "tcp", "localhost:5432")
+	require.NoError(t, err)
+
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS13})
+	client := tls.Client(dialed, &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13}) //nolint: gosec // test
+
+	go func() { _ = server.Handshake() }()
+
+	require.NoError(t, client.Handshake())
+
+	stats := newTLSStats(logger.Global())
+	stats.record(client)
+	stats.record(client)
+	stats.record(&dialedConn{Conn: serverConn, dialed: time.Now()})
+
+	summary := stats.Summary()
+	require.Len(t, summary, 2)
+	require.Equal(t, "TLS 1.3", summary[0].Version)
+	require.NotEmpty(t, summary[0].Cipher)
+	require.Equal(t, uint64(2), summary[0].Connections)
+	require.Positive(t, summary[0].Setup)
+	require.Equal(t, tlsVersionPlaintext, summary[1].Version)
+	require.Equal(t, uint64(1), summary[1].Connections)
+
+	stats.LogStats(logger.Global())
+
+	var nilStats *TLSStats
+	require.Nil(t, nilStats.Summary())
+}
@@ -0,0 +1,135 @@
+package pool
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// tlsVersionPlaintext labels connections without TLS.
+const tlsVersionPlaintext = "plaintext"
+
+// TLSSummary counts pool connections by negotiated TLS version and cipher suite.
+// Setup is the total time from the TCP connect to a ready connection: TLS handshake, startup and authentication.
+type TLSSummary struct {
+	Version     string        `json:"version"`
+	Cipher      string        `json:"cipher"`
+	Connections uint64        `json:"connections"`
+	Setup       time.Duration `json:"setup_ns"`
+}
+
+// TLSStats records how every pool connection was secured.
+type TLSStats struct {
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	summary map[[2]string]*TLSSummary
+}
+
+func newTLSStats(logger *zap.Logger) *TLSStats {
+	return &TLSStats{
+		logger:  logger,
+		summary: make(map[[2]string]*TLSSummary),
+	}
+}
+
+// dialedConn remembers when the TCP connection was established.
+type dialedConn struct {
+	net.Conn
+	dialed time.Time
+}
+
+// wrapDial stamps connections of the dial function, so setup time can be measured after connect.
+func wrapDial(dial pgconn.DialFunc) pgconn.DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &dialedConn{Conn: conn, dialed: time.Now()}, nil
+	}
+}
+
+// connected records TLS version and cipher of a new pool connection.
+func (s *TLSStats) connected(conn *pgconn.PgConn) {
+	if s == nil || conn.Conn() == nil {
+		return
+	}
+
+	s.record(conn.Conn())
+}
+
+func (s *TLSStats) record(netConn net.Conn) {
+	version, cipher := tlsVersionPlaintext, ""
+
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		version = tls.VersionName(state.Version)
+		cipher = tls.CipherSuiteName(state.CipherSuite)
+		netConn = tlsConn.NetConn()
+	}
+
+	var setup time.Duration
+	if dialed, ok := netConn.(*dialedConn); ok {
+		setup = time.Since(dialed.dialed)
+	}
+
+	s.logger.Debug("connection established",
+		zap.String("tls_version", version),
+		zap.String("cipher", cipher),
+		zap.Duration("setup", setup))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{version, cipher}
+
+	summary, ok := s.summary[key]
+	if !ok {
+		summary = &TLSSummary{Version: version, Cipher: cipher}
+		s.summary[key] = summary
+	}
+
+	summary.Connections++
+	summary.Setup += setup
+}
+
+// Summary returns connection counts sorted by version and cipher.
+func (s *TLSStats) Summary() []TLSSummary {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := make([]TLSSummary, 0, len(s.summary))
+	for _, item := range s.summary {
+		summary = append(summary, *item)
+	}
+
+	slices.SortFunc(summary, func(a, b TLSSummary) int {
+		return cmp.Or(cmp.Compare(a.Version, b.Version), cmp.Compare(a.Cipher, b.Cipher))
+	})
+
+	return summary
+}
+
+// LogStats logs connection counts and mean setup time by TLS version and cipher.
+func (s *TLSStats) LogStats(logger *zap.Logger) {
+	for _, item := range s.Summary() {
+		logger.Info("connection tls stats",
+			zap.String("tls_version", item.Version),
+			zap.String("cipher", item.Cipher),
+			zap.Uint64("connections", item.Connections),
+			zap.Duration("mean_setup", item.Setup/time.Duration(item.Connections)))
+	}
+}
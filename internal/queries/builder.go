@@ -3,6 +3,10 @@ package queries
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
 
 	"github.com/google/uuid"
 	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
@@ -11,16 +15,51 @@ import (
 	"go.uber.org/zap"
 
 	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+	"github.com/stroppy-io/stroppy-core/pkg/protovalue"
 	"github.com/stroppy-io/stroppy-core/pkg/utils/errchan"
+
+	"github.com/stroppy-io/stroppy-postgres/internal/config"
 )
 
+const (
+	insertModeKey      = "insert_mode"
+	insertBatchSizeKey = "insert_batch_size"
+
+	defaultInsertBatchSize = 1000
+)
+
+// Schema lists db_specific keys read by the query builder.
+var Schema = config.Schema{
+	insertModeKey:      config.KindString,
+	insertBatchSizeKey: config.KindInt,
+}
+
 var (
-	ErrUnsupportedType  = errors.New("unsupported value type")
-	ErrUnknownQueryType = errors.New("unknown query type")
+	ErrUnsupportedType       = errors.New("unsupported value type")
+	ErrUnknownQueryType      = errors.New("unknown query type")
+	ErrUnsupportedInsertMode = errors.New("unsupported insert mode")
+	ErrInvalidBatchSize      = errors.New("invalid insert batch size")
+)
+
+// InsertMode defines how insert-only query units are built.
+type InsertMode int
+
+const (
+	// InsertModeInsert builds one INSERT statement per generated row.
+	InsertModeInsert InsertMode = iota
+	// InsertModeCopy builds chunks of rows loaded with COPY FROM STDIN.
+	InsertModeCopy
+	// InsertModeValues folds several rows into one multi-row INSERT ... VALUES statement.
+	InsertModeValues
 )
 
 type QueryBuilder struct {
-	generators Generators
+	generators      Generators
+	plans           queryPlans
+	insertMode      InsertMode
+	insertBatchSize uint64
+	// fallbacks holds names of queries already reported as built row by row despite the insert mode.
+	fallbacks sync.Map
 }
 
 func NewQueryBuilder(runContext *stroppy.StepContext) (*QueryBuilder, error) {
@@ -29,11 +68,65 @@ func NewQueryBuilder(runContext *stroppy.StepContext) (*QueryBuilder, error) {
 		return nil, err
 	}
 
+	plans, err := compileStepPlans(runContext, gens)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgMap, err := protovalue.ValueStructToMap(runContext.GetGlobalConfig().GetRun().GetDriver().GetDbSpecific())
+	if err != nil {
+		return nil, err
+	}
+
+	insertMode, err := parseInsertMode(cfgMap)
+	if err != nil {
+		return nil, err
+	}
+
+	insertBatchSize := uint64(defaultInsertBatchSize)
+
+	if rawAny, exists := cfgMap[insertBatchSizeKey]; exists {
+		batchSize, ok := config.Int(rawAny)
+		if !ok || batchSize < 1 {
+			return nil, fmt.Errorf(`"%s" must be a positive integer, got %v: %w`,
+				insertBatchSizeKey, rawAny, ErrInvalidBatchSize)
+		}
+
+		insertBatchSize = uint64(batchSize)
+	}
+
 	return &QueryBuilder{
-		generators: gens,
+		generators:      gens,
+		plans:           plans,
+		insertMode:      insertMode,
+		insertBatchSize: insertBatchSize,
 	}, nil
 }
 
+func parseInsertMode(cfgMap map[string]any) (InsertMode, error) {
+	rawAny, exists := cfgMap[insertModeKey]
+	if !exists {
+		return InsertModeInsert, nil
+	}
+
+	optMap := map[string]InsertMode{
+		"insert": InsertModeInsert,
+		"copy":   InsertModeCopy,
+		"values": InsertModeValues,
+	}
+
+	rawStr, _ := config.String(rawAny)
+	if mode, ok := optMap[rawStr]; ok {
+		return mode, nil
+	}
+
+	return 0, fmt.Errorf(`"%v" invalid for "%s" key; supported values are %v: %w`,
+		rawAny, insertModeKey,
+		slices.Collect(maps.Keys(optMap)),
+		ErrUnsupportedInsertMode,
+	)
+}
+
 func (q *QueryBuilder) BuildStream(
 	ctx context.Context,
 	logger *zap.Logger,
@@ -79,28 +172,81 @@ func (q *QueryBuilder) internalBuild(
 			channel,
 		)
 	case *stroppy.StepUnitDescriptor_Query:
-		NewQuery(
-			ctx,
-			logger,
-			q.generators,
-			buildQueriesContext.GetContext(),
-			buildQueriesContext.GetUnit().GetQuery(),
-			channel,
-		)
+		q.buildQuery(ctx, logger, buildQueriesContext, channel)
 	case *stroppy.StepUnitDescriptor_Transaction:
-		NewTransaction(
-			ctx,
-			logger,
-			q.generators,
-			buildQueriesContext.GetContext(),
-			buildQueriesContext.GetUnit().GetTransaction(),
-			channel,
-		)
+		q.buildTransaction(ctx, logger, buildQueriesContext, channel)
 	default:
-		panic(ErrUnknownQueryType)
+		errchan.Send[stroppy.DriverTransaction](channel, nil, fmt.Errorf("%T: %w",
+			buildQueriesContext.GetUnit().GetType(), ErrUnknownQueryType))
+		errchan.Close[stroppy.DriverTransaction](channel)
 	}
 }
 
+// buildQuery picks the way query unit is built according to the configured insert mode.
+func (q *QueryBuilder) buildQuery(
+	ctx context.Context,
+	logger *zap.Logger,
+	buildQueriesContext *stroppy.UnitBuildContext,
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	plan, err := q.plans.get(q.generators, buildQueriesContext.GetContext(), buildQueriesContext.GetUnit().GetQuery())
+	if err != nil {
+		errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+		errchan.Close[stroppy.DriverTransaction](channel)
+
+		return
+	}
+
+	switch {
+	case q.insertMode == InsertModeCopy && plan.insert != nil:
+		newPlannedCopyQuery(ctx, logger, plan, q.insertBatchSize, channel)
+	case q.insertMode == InsertModeValues && plan.values != nil:
+		newPlannedValuesQuery(ctx, logger, plan, q.insertBatchSize, channel)
+	default:
+		q.warnFallback(logger, plan)
+		newPlannedQuery(ctx, logger, plan, channel)
+	}
+}
+
+// warnFallback reports once per query name that a query not eligible for the insert mode is built row by row.
+func (q *QueryBuilder) warnFallback(logger *zap.Logger, plan *queryPlan) {
+	if q.insertMode == InsertModeInsert {
+		return
+	}
+
+	name := plan.descriptor.GetName()
+	if _, reported := q.fallbacks.LoadOrStore(name, struct{}{}); reported {
+		return
+	}
+
+	logger.Warn(`query is not eligible for "insert_mode", it is built as a statement per row`,
+		zap.String("name", name))
+}
+
+func (q *QueryBuilder) buildTransaction(
+	ctx context.Context,
+	logger *zap.Logger,
+	buildQueriesContext *stroppy.UnitBuildContext,
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	descriptor := buildQueriesContext.GetUnit().GetTransaction()
+	plans := make([]*queryPlan, 0, len(descriptor.GetQueries()))
+
+	for _, query := range descriptor.GetQueries() {
+		plan, err := q.plans.get(q.generators, buildQueriesContext.GetContext(), query)
+		if err != nil {
+			errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+			errchan.Close[stroppy.DriverTransaction](channel)
+
+			return
+		}
+
+		plans = append(plans, plan)
+	}
+
+	newPlannedTransaction(ctx, logger, descriptor, plans, channel)
+}
+
 func (q *QueryBuilder) ValueToPgxValue(value *stroppy.Value) (any, error) {
 	switch value.GetType().(type) {
 	case *stroppy.Value_Null:
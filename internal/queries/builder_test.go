@@ -313,12 +313,8 @@ func TestQueryBuilder_Build_UnknownType(t *testing.T) {
 	ctx := context.Background()
 	lg := zap.NewNop()
 
-	// Тестируем BuildStream напрямую, чтобы поймать панику
-	channel := make(errchan.Chan[stroppy.DriverTransaction])
-
-	require.Panics(t, func() {
-		builder.BuildStream(ctx, lg, unitBuildContext, channel)
-	})
+	_, err := builder.Build(ctx, lg, unitBuildContext)
+	require.ErrorIs(t, err, ErrUnknownQueryType)
 }
 
 func TestValueToPgxValue_AllTypes(t *testing.T) {
@@ -0,0 +1,218 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+	"github.com/stroppy-io/stroppy-core/pkg/utils/errchan"
+)
+
+var ErrNotInsertOnly = errors.New("query is not a single row insert of bare placeholders")
+
+// copyRequestMarker starts requests of COPY chunks, so they are told apart from user SQL
+// which is never executed with pgx.CopyFrom. Being a comment, the request is still readable SQL in logs.
+const copyRequestMarker = "/* stroppy:copy */ "
+
+var (
+	insertRe      = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+([\w."]+)\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)\s*;?\s*$`)
+	placeholderRe = regexp.MustCompile(`^\$\{(\w+)\}$`)
+	copyRe        = regexp.MustCompile(`^COPY ([\w."]+) \(([^)]*)\) FROM STDIN$`)
+)
+
+// insertStatement is a single row "INSERT INTO t (a, b) VALUES (${a}, ${b})" descriptor
+// where every value is a bare placeholder, so rows can be streamed with COPY instead.
+type insertStatement struct {
+	table   string
+	columns []string
+	// paramIdx maps column position to the descriptor param index.
+	paramIdx []int
+}
+
+// splitList splits list by sep outside of quoted identifiers and strings, e.g. `"a,b", c` or `"my.schema".t`.
+func splitList(list string, sep byte) []string {
+	var items []string
+
+	start := 0
+
+	for pos := 0; pos < len(list); {
+		if list[pos] != sep {
+			pos = skipToken(list, pos)
+
+			continue
+		}
+
+		items = append(items, strings.TrimSpace(list[start:pos]))
+		pos++
+		start = pos
+	}
+
+	return append(items, strings.TrimSpace(list[start:]))
+}
+
+// unquoteIdent returns the identifier name like PostgreSQL resolves it:
+// quoted identifiers are taken as is, unquoted ones are folded to lower case.
+func unquoteIdent(ident string) string {
+	if len(ident) >= 2 && strings.HasPrefix(ident, `"`) && strings.HasSuffix(ident, `"`) {
+		return strings.ReplaceAll(ident[1:len(ident)-1], `""`, `"`)
+	}
+
+	return strings.ToLower(ident)
+}
+
+// parseInsert recognises insert-only descriptors, false means descriptor must be executed as is.
+func parseInsert(descriptor *stroppy.QueryDescriptor) (*insertStatement, bool) {
+	match := insertRe.FindStringSubmatch(descriptor.GetSql())
+	if match == nil {
+		return nil, false
+	}
+
+	columns := splitList(match[2], ',')
+	values := splitList(match[3], ',')
+
+	if len(columns) != len(values) || len(values) != len(descriptor.GetParams()) {
+		return nil, false
+	}
+
+	paramsIdx := make(map[string]int, len(descriptor.GetParams()))
+	for i, param := range descriptor.GetParams() {
+		paramsIdx[param.GetName()] = i
+	}
+
+	stmt := &insertStatement{
+		table:    match[1],
+		columns:  columns,
+		paramIdx: make([]int, len(values)),
+	}
+
+	for i, value := range values {
+		placeholder := placeholderRe.FindStringSubmatch(value)
+		if placeholder == nil {
+			return nil, false
+		}
+
+		idx, ok := paramsIdx[placeholder[1]]
+		if !ok {
+			return nil, false
+		}
+
+		stmt.paramIdx[i] = idx
+	}
+
+	return stmt, true
+}
+
+func (s *insertStatement) copyRequest() string {
+	return fmt.Sprintf("%sCOPY %s (%s) FROM STDIN", copyRequestMarker, s.table, strings.Join(s.columns, ", "))
+}
+
+// ParseCopyRequest extracts COPY target from the DriverQuery request of a COPY chunk.
+func ParseCopyRequest(request string) (pgx.Identifier, []string, bool) {
+	request, ok := strings.CutPrefix(request, copyRequestMarker)
+	if !ok {
+		return nil, nil, false
+	}
+
+	match := copyRe.FindStringSubmatch(request)
+	if match == nil {
+		return nil, nil, false
+	}
+
+	tableName := splitList(match[1], '.')
+	for i := range tableName {
+		tableName[i] = unquoteIdent(tableName[i])
+	}
+
+	columns := splitList(match[2], ',')
+	for i := range columns {
+		columns[i] = unquoteIdent(columns[i])
+	}
+
+	return tableName, columns, true
+}
+
+// IsCopyTransaction reports whether all queries of the transaction are rows of the same COPY chunk.
+func IsCopyTransaction(transaction *stroppy.DriverTransaction) bool {
+	queries := transaction.GetQueries()
+	if len(queries) == 0 {
+		return false
+	}
+
+	request := queries[0].GetRequest()
+	if !strings.HasPrefix(request, copyRequestMarker) {
+		return false
+	}
+
+	for _, query := range queries[1:] {
+		if query.GetRequest() != request {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newPlannedCopyQuery streams rows of insert-only descriptor as transactions of chunkSize queries.
+// Every query carries one row in column order and the same COPY chunk request,
+// which driver executes with pgx.CopyFrom. The plan must have insert set.
+func newPlannedCopyQuery(
+	ctx context.Context,
+	lg *zap.Logger,
+	plan *queryPlan,
+	chunkSize uint64,
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	defer errchan.Close[stroppy.DriverTransaction](channel)
+
+	descriptor, stmt := plan.descriptor, plan.insert
+
+	lg.Debug("build copy query",
+		zap.String("name", descriptor.GetName()),
+		zap.String("table", stmt.table),
+		zap.Strings("columns", stmt.columns),
+		zap.Uint64("chunk_size", chunkSize),
+	)
+
+	request := stmt.copyRequest()
+	chunk := make([]*stroppy.DriverQuery, 0, min(chunkSize, descriptor.GetCount()))
+
+	for i := uint64(0); i < descriptor.GetCount(); i++ { //nolint: intrange // allow
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		paramsValues, err := plan.params()
+		if err != nil {
+			errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+
+			return
+		}
+
+		row := make([]*stroppy.Value, len(stmt.paramIdx))
+		for col, idx := range stmt.paramIdx {
+			row[col] = paramsValues[idx]
+		}
+
+		chunk = append(chunk, &stroppy.DriverQuery{
+			Name:    descriptor.GetName(),
+			Request: request,
+			Params:  row,
+		})
+
+		if uint64(len(chunk)) == chunkSize || i == descriptor.GetCount()-1 {
+			errchan.Send[stroppy.DriverTransaction](channel, &stroppy.DriverTransaction{
+				Queries: chunk,
+			}, nil)
+
+			chunk = make([]*stroppy.DriverQuery, 0, chunkSize)
+		}
+	}
+}
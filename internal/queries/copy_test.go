@@ -0,0 +1,183 @@
+package queries
+
+import (
+	"context"
+	"testing"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/stroppy-io/stroppy-core/pkg/generate"
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+func constInt32Param(name string, value int32) *stroppy.QueryParamDescriptor {
+	return &stroppy.QueryParamDescriptor{Name: name, GenerationRule: &stroppy.Generation_Rule{
+		Type: &stroppy.Generation_Rule_Int32Rules{
+			Int32Rules: &stroppy.Generation_Rules_Int32Rule{
+				Constant: proto.Int32(value),
+			},
+		},
+	}}
+}
+
+// buildInsert builds the insert descriptor as a query unit with the insert mode and batch size.
+func buildInsert(
+	t *testing.T,
+	mode InsertMode,
+	batchSize uint64,
+	descriptor *stroppy.QueryDescriptor,
+) []*stroppy.DriverTransaction {
+	t.Helper()
+
+	builder, unitContext := newInsertBuilder(t, mode, batchSize, descriptor)
+
+	transactions, err := builder.Build(context.Background(), zap.NewNop(), unitContext)
+	require.NoError(t, err)
+
+	return transactions.GetTransactions()
+}
+
+func newInsertBuilder(
+	t *testing.T,
+	mode InsertMode,
+	batchSize uint64,
+	descriptor *stroppy.QueryDescriptor,
+) (*QueryBuilder, *stroppy.UnitBuildContext) {
+	t.Helper()
+
+	step := &stroppy.StepDescriptor{
+		Name:  "test",
+		Units: []*stroppy.StepUnitDescriptor{{Type: &stroppy.StepUnitDescriptor_Query{Query: descriptor}}},
+	}
+	buildContext := &stroppy.StepContext{
+		GlobalConfig: &stroppy.Config{Run: &stroppy.RunConfig{Seed: 42}},
+		Step:         step,
+	}
+
+	generators := cmap.NewStringer[GeneratorID, generate.ValueGenerator]()
+	for _, param := range descriptor.GetParams() {
+		generator, err := generate.NewValueGenerator(42, descriptor.GetCount(), param)
+		require.NoError(t, err)
+		generators.Set(NewGeneratorID("test", descriptor.GetName(), param.GetName()), generator)
+	}
+
+	builder := &QueryBuilder{generators: generators, insertMode: mode, insertBatchSize: batchSize}
+
+	return builder, &stroppy.UnitBuildContext{Context: buildContext, Unit: step.GetUnits()[0]}
+}
+
+func TestParseInsert(t *testing.T) {
+	params := []*stroppy.QueryParamDescriptor{constInt32Param("id", 1), constInt32Param("v", 2)}
+
+	stmt, ok := parseInsert(&stroppy.QueryDescriptor{
+		Sql:    "insert into public.t (v, id) values (${v}, ${id});",
+		Params: params,
+	})
+	require.True(t, ok)
+	require.Equal(t, "public.t", stmt.table)
+	require.Equal(t, []string{"v", "id"}, stmt.columns)
+	require.Equal(t, []int{1, 0}, stmt.paramIdx)
+	require.Equal(t, copyRequestMarker+"COPY public.t (v, id) FROM STDIN", stmt.copyRequest())
+
+	for _, sql := range []string{
+		"INSERT INTO t (id, v) VALUES (${id}, ${v} + 1)",
+		"INSERT INTO t (id, v) VALUES (${id}, ${v}) ON CONFLICT DO NOTHING",
+		"INSERT INTO t (id, v) SELECT ${id}, ${v}",
+		"UPDATE t SET v = ${v} WHERE id = ${id}",
+	} {
+		_, ok = parseInsert(&stroppy.QueryDescriptor{Sql: sql, Params: params})
+		require.False(t, ok, sql)
+	}
+}
+
+func TestParseCopyRequest(t *testing.T) {
+	tableName, columns, ok := ParseCopyRequest(copyRequestMarker + `COPY "public".T ("Id", "a""b", c) FROM STDIN`)
+	require.True(t, ok)
+	require.Equal(t, []string{"public", "t"}, []string(tableName))
+	require.Equal(t, []string{"Id", `a"b`, "c"}, columns)
+
+	tableName, columns, ok = ParseCopyRequest(copyRequestMarker + `COPY "my.schema"."t.1" ("a,b", c) FROM STDIN`)
+	require.True(t, ok)
+	require.Equal(t, []string{"my.schema", "t.1"}, []string(tableName))
+	require.Equal(t, []string{"a,b", "c"}, columns)
+
+	_, _, ok = ParseCopyRequest("COPY t (a, b) FROM STDIN")
+	require.False(t, ok, "user SQL is not a COPY chunk")
+
+	_, _, ok = ParseCopyRequest(copyRequestMarker + "INSERT INTO t (a) VALUES ($1)")
+	require.False(t, ok)
+}
+
+func TestIsCopyTransaction(t *testing.T) {
+	request := copyRequestMarker + "COPY t (a) FROM STDIN"
+
+	require.True(t, IsCopyTransaction(&stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Request: request}, {Request: request}},
+	}))
+	require.False(t, IsCopyTransaction(&stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Request: "COPY t (a) FROM STDIN"}},
+	}), "user SQL is never run with CopyFrom")
+	require.False(t, IsCopyTransaction(&stroppy.DriverTransaction{
+		Queries: []*stroppy.DriverQuery{{Request: request}, {Request: "SELECT 1"}},
+	}))
+	require.False(t, IsCopyTransaction(&stroppy.DriverTransaction{}))
+}
+
+func TestQueryBuilder_Build_Copy(t *testing.T) {
+	transactions := buildInsert(t, InsertModeCopy, 2, &stroppy.QueryDescriptor{
+		Name:   "load",
+		Sql:    `INSERT INTO t (v, "Id") VALUES (${v}, ${id})`,
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("id", 1), constInt32Param("v", 2)},
+		Count:  5,
+	})
+	require.Len(t, transactions, 3)
+	require.Len(t, transactions[0].Queries, 2)
+	require.Len(t, transactions[2].Queries, 1)
+	require.True(t, IsCopyTransaction(transactions[0]))
+	require.Equal(t, int32(2), transactions[0].Queries[0].Params[0].GetInt32())
+	require.Equal(t, int32(1), transactions[0].Queries[0].Params[1].GetInt32())
+
+	tableName, columns, ok := ParseCopyRequest(transactions[0].Queries[0].Request)
+	require.True(t, ok)
+	require.Equal(t, []string{"t"}, []string(tableName))
+	require.Equal(t, []string{"v", "Id"}, columns)
+}
+
+func TestQueryBuilder_Build_CopyQuotedNames(t *testing.T) {
+	transactions := buildInsert(t, InsertModeCopy, 2, &stroppy.QueryDescriptor{
+		Name:   "load",
+		Sql:    `INSERT INTO "my.schema".t ("a,b", v) VALUES (${ab}, ${v})`,
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("ab", 1), constInt32Param("v", 2)},
+		Count:  2,
+	})
+	require.Len(t, transactions, 1)
+
+	tableName, columns, ok := ParseCopyRequest(transactions[0].Queries[0].Request)
+	require.True(t, ok)
+	require.Equal(t, []string{"my.schema", "t"}, []string(tableName))
+	require.Equal(t, []string{"a,b", "v"}, columns)
+}
+
+func TestQueryBuilder_Build_InsertModeFallback(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+
+	builder, unitContext := newInsertBuilder(t, InsertModeCopy, 2, &stroppy.QueryDescriptor{
+		Name:   "touch",
+		Sql:    "UPDATE t SET v = ${v}",
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("v", 2)},
+		Count:  3,
+	})
+
+	for range 2 {
+		transactions, err := builder.Build(context.Background(), zap.New(core), unitContext)
+		require.NoError(t, err)
+		require.Len(t, transactions.GetTransactions(), 3)
+		require.False(t, IsCopyTransaction(transactions.GetTransactions()[0]))
+	}
+
+	require.Equal(t, 1, logs.FilterField(zap.String("name", "touch")).Len(), "fallback is reported once")
+}
@@ -0,0 +1,153 @@
+package queries
+
+import (
+	"fmt"
+
+	"github.com/stroppy-io/stroppy-core/pkg/generate"
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+// queryPlan is a QueryDescriptor compiled once: placeholders are resolved,
+// SQL is rewritten and generators are looked up in the descriptor params order,
+// so building a query costs only values generation.
+type queryPlan struct {
+	descriptor *stroppy.QueryDescriptor
+	tmpl       *sqlTemplate
+	request    string
+	generators []generate.ValueGenerator
+	// insert is set for descriptors which can be loaded with COPY.
+	insert *insertStatement
+	// values is set for descriptors which can be folded into multi-row insert.
+	values *valuesInsert
+}
+
+func newQueryPlan(
+	generators Generators,
+	buildContext *stroppy.StepContext,
+	descriptor *stroppy.QueryDescriptor,
+) (*queryPlan, error) {
+	tmpl, err := newSQLTemplate(descriptor.GetSql(), descriptor.GetParams())
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", descriptor.GetName(), err)
+	}
+
+	plan := &queryPlan{
+		descriptor: descriptor,
+		tmpl:       tmpl,
+		request:    tmpl.render(0),
+		generators: make([]generate.ValueGenerator, 0, len(descriptor.GetParams())),
+	}
+
+	for _, column := range descriptor.GetParams() {
+		gen, ok := generators.Get(NewGeneratorID(
+			buildContext.GetStep().GetName(),
+			descriptor.GetName(),
+			column.GetName(),
+		))
+		if !ok {
+			return nil, fmt.Errorf("no generator for column %s", column.GetName()) //nolint: err113
+		}
+
+		plan.generators = append(plan.generators, gen)
+	}
+
+	if stmt, ok := parseInsert(descriptor); ok {
+		plan.insert = stmt
+	}
+
+	if stmt, ok := parseValuesInsert(descriptor); ok {
+		plan.values = stmt
+	}
+
+	return plan, nil
+}
+
+func (p *queryPlan) params() ([]*stroppy.Value, error) {
+	paramsValues := make([]*stroppy.Value, len(p.generators))
+
+	for i, gen := range p.generators {
+		protoValue, err := gen.Next()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to generate value for column %s: %w",
+				p.descriptor.GetParams()[i].GetName(),
+				err,
+			)
+		}
+
+		paramsValues[i] = protoValue
+	}
+
+	return paramsValues, nil
+}
+
+func (p *queryPlan) newQuery() (*stroppy.DriverQuery, error) {
+	paramsValues, err := p.params()
+	if err != nil {
+		return nil, err
+	}
+
+	return &stroppy.DriverQuery{
+		Name:    p.descriptor.GetName(),
+		Request: p.request,
+		Params:  paramsValues,
+	}, nil
+}
+
+type planID struct {
+	step  string
+	query string
+}
+
+// queryPlans are compiled once in NewQueryBuilder and only read afterwards.
+type queryPlans map[planID]*queryPlan
+
+// compileStepPlans compiles every query of the benchmark
+// the same way CollectStepGenerators collects their generators.
+func compileStepPlans(runContext *stroppy.StepContext, generators Generators) (queryPlans, error) {
+	plans := make(queryPlans)
+
+	add := func(descriptor *stroppy.QueryDescriptor) error {
+		plan, err := newQueryPlan(generators, runContext, descriptor)
+		if err != nil {
+			return err
+		}
+
+		plans[planID{step: runContext.GetStep().GetName(), query: descriptor.GetName()}] = plan
+
+		return nil
+	}
+
+	for _, step := range runContext.GetGlobalConfig().GetBenchmark().GetSteps() {
+		for _, unit := range step.GetUnits() {
+			switch unit.GetType().(type) {
+			case *stroppy.StepUnitDescriptor_Query:
+				if err := add(unit.GetQuery()); err != nil {
+					return nil, err
+				}
+			case *stroppy.StepUnitDescriptor_Transaction:
+				for _, query := range unit.GetTransaction().GetQueries() {
+					if err := add(query); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return plans, nil
+}
+
+// get returns compiled plan of the descriptor, descriptors unknown at builder creation are compiled on demand.
+func (p queryPlans) get(
+	generators Generators,
+	buildContext *stroppy.StepContext,
+	descriptor *stroppy.QueryDescriptor,
+) (*queryPlan, error) {
+	plan, ok := p[planID{step: buildContext.GetStep().GetName(), query: descriptor.GetName()}]
+	if ok && plan.descriptor.GetSql() == descriptor.GetSql() {
+		return plan, nil
+	}
+
+	return newQueryPlan(generators, buildContext, descriptor)
+}
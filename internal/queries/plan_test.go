@@ -0,0 +1,66 @@
+package queries
+
+import (
+	"testing"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stroppy-io/stroppy-core/pkg/generate"
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+func TestQueryPlans_Get(t *testing.T) {
+	query := &stroppy.QueryDescriptor{
+		Name:   "q1",
+		Sql:    "SELECT * FROM t WHERE id=${id}",
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("id", 10)},
+		Count:  1,
+	}
+	buildContext := &stroppy.StepContext{
+		GlobalConfig: &stroppy.Config{Run: &stroppy.RunConfig{Seed: 42}},
+		Step:         &stroppy.StepDescriptor{Name: "test"},
+	}
+
+	generators := cmap.NewStringer[GeneratorID, generate.ValueGenerator]()
+	generator, err := generate.NewValueGenerator(42, 1, query.GetParams()[0])
+	require.NoError(t, err)
+	generators.Set(NewGeneratorID("test", "q1", "id"), generator)
+
+	compiled, err := newQueryPlan(generators, buildContext, query)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM t WHERE id=$1", compiled.request)
+	require.Len(t, compiled.generators, 1)
+
+	plans := queryPlans{planID{step: "test", query: "q1"}: compiled}
+
+	plan, err := plans.get(generators, buildContext, query)
+	require.NoError(t, err)
+	require.Same(t, compiled, plan)
+
+	driverQuery, err := plan.newQuery()
+	require.NoError(t, err)
+	require.Equal(t, int32(10), driverQuery.GetParams()[0].GetInt32())
+
+	changed := &stroppy.QueryDescriptor{
+		Name:   "q1",
+		Sql:    "DELETE FROM t WHERE id=${id}",
+		Params: query.GetParams(),
+	}
+	plan, err = plans.get(generators, buildContext, changed)
+	require.NoError(t, err)
+	require.NotSame(t, compiled, plan)
+	require.Equal(t, "DELETE FROM t WHERE id=$1", plan.request)
+}
+
+func TestNewQueryPlan_MissingGenerator(t *testing.T) {
+	query := &stroppy.QueryDescriptor{
+		Name:   "q1",
+		Sql:    "SELECT * FROM t WHERE id=${id}",
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("id", 10)},
+	}
+	buildContext := &stroppy.StepContext{Step: &stroppy.StepDescriptor{Name: "test"}}
+
+	_, err := newQueryPlan(cmap.NewStringer[GeneratorID, generate.ValueGenerator](), buildContext, query)
+	require.Error(t, err)
+}
@@ -2,8 +2,6 @@ package queries
 
 import (
 	"context"
-	"fmt"
-	"strings"
 
 	"go.uber.org/zap"
 
@@ -11,66 +9,36 @@ import (
 	"github.com/stroppy-io/stroppy-core/pkg/utils/errchan"
 )
 
-func newQuery(
+func NewQuery(
+	ctx context.Context,
+	lg *zap.Logger,
 	generators Generators,
 	buildContext *stroppy.StepContext,
 	descriptor *stroppy.QueryDescriptor,
-) (*stroppy.DriverQuery, error) {
-	paramsValues := make([]*stroppy.Value, 0)
-
-	for _, column := range descriptor.GetParams() {
-		gen, ok := generators.Get(NewGeneratorID(
-			buildContext.GetStep().GetName(),
-			descriptor.GetName(),
-			column.GetName(),
-		))
-		if !ok {
-			return nil, fmt.Errorf("no generator for column %s", column.GetName()) //nolint: err113
-		}
-
-		protoValue, err := gen.Next()
-		if err != nil {
-			return nil, fmt.Errorf(
-				"failed to generate value for column %s: %w",
-				column.GetName(),
-				err,
-			)
-		}
-
-		paramsValues = append(paramsValues, protoValue)
-	}
-
-	resSQL := descriptor.GetSql()
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	plan, err := newQueryPlan(generators, buildContext, descriptor)
+	if err != nil {
+		errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+		errchan.Close[stroppy.DriverTransaction](channel)
 
-	for idx, param := range descriptor.GetParams() {
-		// TODO: evaluate replace regex
-		resSQL = strings.ReplaceAll(
-			resSQL,
-			fmt.Sprintf("${%s}", param.GetName()),
-			fmt.Sprintf("$%d", idx+1),
-		)
+		return
 	}
 
-	return &stroppy.DriverQuery{
-		Name:    descriptor.GetName(),
-		Request: resSQL,
-		Params:  paramsValues,
-	}, nil
+	newPlannedQuery(ctx, lg, plan, channel)
 }
 
-func NewQuery(
+func newPlannedQuery(
 	ctx context.Context,
 	lg *zap.Logger,
-	generators Generators,
-	buildContext *stroppy.StepContext,
-	descriptor *stroppy.QueryDescriptor,
+	plan *queryPlan,
 	channel errchan.Chan[stroppy.DriverTransaction],
 ) {
 	defer errchan.Close[stroppy.DriverTransaction](channel)
 	lg.Debug("build query",
-		zap.String("name", descriptor.GetName()),
-		zap.String("query", descriptor.GetSql()),
-		zap.Any("params", descriptor.GetParams()),
+		zap.String("name", plan.descriptor.GetName()),
+		zap.String("query", plan.descriptor.GetSql()),
+		zap.Any("params", plan.descriptor.GetParams()),
 	)
 
 	for {
@@ -78,8 +46,8 @@ func NewQuery(
 		case <-ctx.Done():
 			return
 		default:
-			for i := uint64(0); i < descriptor.GetCount(); i++ { //nolint: intrange // allow
-				query, err := newQuery(generators, buildContext, descriptor)
+			for i := uint64(0); i < plan.descriptor.GetCount(); i++ { //nolint: intrange // allow
+				query, err := plan.newQuery()
 				if err != nil {
 					errchan.Send[stroppy.DriverTransaction](channel, nil, err)
 
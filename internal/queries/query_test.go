@@ -103,11 +103,8 @@ func TestNewQuery_Error(t *testing.T) {
 		NewQuery(ctx, lg, generators, buildContext, descriptor, channel)
 	}()
 
-	transactions, err := errchan.Collect[stroppy.DriverTransaction](channel)
-	require.NoError(t, err)
-	require.Len(t, transactions, 1)
-	require.Len(t, transactions[0].Queries, 1)
-	require.Empty(t, transactions[0].Queries[0].Params)
+	_, err := errchan.Collect[stroppy.DriverTransaction](channel)
+	require.ErrorIs(t, err, ErrUnknownPlaceholder)
 }
 
 func TestNewQuerySync_Success(t *testing.T) {
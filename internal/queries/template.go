@@ -0,0 +1,196 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+var (
+	ErrUnknownPlaceholder      = errors.New("unknown placeholder")
+	ErrUnusedParam             = errors.New("param is not used in query")
+	ErrUnterminatedPlaceholder = errors.New("unterminated placeholder")
+)
+
+// sqlTemplate is descriptor SQL split around ${name} placeholders.
+// Placeholders are recognised only in plain SQL text: string literals, quoted identifiers,
+// comments and dollar-quoted bodies are copied as is.
+type sqlTemplate struct {
+	// parts are SQL chunks between placeholders, len(parts) == len(refs)+1.
+	parts []string
+	// refs are descriptor param indexes of placeholders.
+	refs []int
+}
+
+func newSQLTemplate(sql string, params []*stroppy.QueryParamDescriptor) (*sqlTemplate, error) {
+	paramsIdx := make(map[string]int, len(params))
+	for i, param := range params {
+		paramsIdx[param.GetName()] = i
+	}
+
+	tmpl := &sqlTemplate{}
+	used := make([]bool, len(params))
+	start := 0
+
+	for pos := 0; pos < len(sql); {
+		if !strings.HasPrefix(sql[pos:], "${") {
+			pos = skipToken(sql, pos)
+
+			continue
+		}
+
+		end := strings.IndexByte(sql[pos:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("at offset %d: %w", pos, ErrUnterminatedPlaceholder)
+		}
+
+		name := sql[pos+2 : pos+end]
+
+		idx, ok := paramsIdx[name]
+		if !ok {
+			return nil, fmt.Errorf(`"${%s}": %w`, name, ErrUnknownPlaceholder)
+		}
+
+		used[idx] = true
+		tmpl.parts = append(tmpl.parts, sql[start:pos])
+		tmpl.refs = append(tmpl.refs, idx)
+		pos += end + 1
+		start = pos
+	}
+
+	tmpl.parts = append(tmpl.parts, sql[start:])
+
+	for i, param := range params {
+		if !used[i] {
+			return nil, fmt.Errorf(`"%s": %w`, param.GetName(), ErrUnusedParam)
+		}
+	}
+
+	return tmpl, nil
+}
+
+// render returns SQL with placeholders replaced by $n, where n = offset + param index + 1.
+func (t *sqlTemplate) render(offset int) string {
+	var buf strings.Builder
+
+	for i, ref := range t.refs {
+		buf.WriteString(t.parts[i])
+		buf.WriteByte('$')
+		buf.WriteString(strconv.Itoa(offset + ref + 1))
+	}
+
+	buf.WriteString(t.parts[len(t.parts)-1])
+
+	return buf.String()
+}
+
+// skipToken returns position right after the token starting at pos.
+// Quoted tokens and comments are skipped as a whole, anything else by one byte.
+// Unterminated quotes and comments run to the end of sql, the server reports them.
+func skipToken(sql string, pos int) int {
+	switch {
+	case sql[pos] == '\'':
+		return skipQuoted(sql, pos+1, '\'', isEscapeString(sql, pos))
+	case sql[pos] == '"':
+		return skipQuoted(sql, pos+1, '"', false)
+	case strings.HasPrefix(sql[pos:], "--"):
+		if end := strings.IndexByte(sql[pos:], '\n'); end >= 0 {
+			return pos + end + 1
+		}
+
+		return len(sql)
+	case strings.HasPrefix(sql[pos:], "/*"):
+		return skipBlockComment(sql, pos)
+	case sql[pos] == '$':
+		if tag, ok := dollarTag(sql, pos); ok {
+			if end := strings.Index(sql[pos+len(tag):], tag); end >= 0 {
+				return pos + len(tag) + end + len(tag)
+			}
+
+			return len(sql)
+		}
+	}
+
+	return pos + 1
+}
+
+// isEscapeString reports whether quote at pos opens E'...' string with backslash escapes.
+func isEscapeString(sql string, pos int) bool {
+	if pos == 0 || (sql[pos-1] != 'E' && sql[pos-1] != 'e') {
+		return false
+	}
+
+	return pos == 1 || !isIdentByte(sql[pos-2])
+}
+
+func skipQuoted(sql string, pos int, quote byte, backslash bool) int {
+	for pos < len(sql) {
+		switch {
+		case backslash && sql[pos] == '\\':
+			pos += 2
+		case sql[pos] == quote && pos+1 < len(sql) && sql[pos+1] == quote:
+			pos += 2
+		case sql[pos] == quote:
+			return pos + 1
+		default:
+			pos++
+		}
+	}
+
+	return len(sql)
+}
+
+// skipBlockComment skips /* ... */ comment, PostgreSQL allows them to be nested.
+func skipBlockComment(sql string, pos int) int {
+	depth := 0
+
+	for pos < len(sql) {
+		switch {
+		case strings.HasPrefix(sql[pos:], "/*"):
+			depth++
+			pos += 2
+		case strings.HasPrefix(sql[pos:], "*/"):
+			depth--
+			pos += 2
+
+			if depth == 0 {
+				return pos
+			}
+		default:
+			pos++
+		}
+	}
+
+	return len(sql)
+}
+
+// dollarTag returns $tag$ opening dollar-quoted string at pos.
+// Positional parameters like $1 and identifiers containing $ are not tags.
+func dollarTag(sql string, pos int) (string, bool) {
+	if pos > 0 && isIdentByte(sql[pos-1]) {
+		return "", false
+	}
+
+	for i := pos + 1; i < len(sql); i++ {
+		switch {
+		case sql[i] == '$':
+			return sql[pos : i+1], true
+		case sql[i] >= '0' && sql[i] <= '9':
+			if i == pos+1 {
+				return "", false
+			}
+		case !isIdentByte(sql[i]):
+			return "", false
+		}
+	}
+
+	return "", false
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= 0x80 ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
@@ -0,0 +1,58 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+func TestNewSQLTemplate(t *testing.T) {
+	params := []*stroppy.QueryParamDescriptor{{Name: "id"}, {Name: "id2"}}
+
+	for _, tc := range []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "SELECT * FROM t WHERE id = ${id} OR id = ${id2} OR parent = ${id}",
+			want: "SELECT * FROM t WHERE id = $1 OR id = $2 OR parent = $1",
+		},
+		{
+			sql:  "SELECT '${id}', 'it''s ${id}', E'\\' ${id}', \"${id}\" FROM t WHERE a = ${id} AND b = ${id2}",
+			want: "SELECT '${id}', 'it''s ${id}', E'\\' ${id}', \"${id}\" FROM t WHERE a = $1 AND b = $2",
+		},
+		{
+			sql:  "SELECT ${id} -- ${id}\n, /* ${id} /* nested ${id} */ ${id} */ ${id2}",
+			want: "SELECT $1 -- ${id}\n, /* ${id} /* nested ${id} */ ${id} */ $2",
+		},
+		{
+			sql:  "DO $body$ BEGIN PERFORM ${id}; END $body$; SELECT $$ ${id} $$, ${id}, ${id2}",
+			want: "DO $body$ BEGIN PERFORM ${id}; END $body$; SELECT $$ ${id} $$, $1, $2",
+		},
+	} {
+		tmpl, err := newSQLTemplate(tc.sql, params)
+		require.NoError(t, err, tc.sql)
+		require.Equal(t, tc.want, tmpl.render(0), tc.sql)
+	}
+}
+
+func TestNewSQLTemplate_Errors(t *testing.T) {
+	params := []*stroppy.QueryParamDescriptor{{Name: "id"}, {Name: "v"}}
+
+	_, err := newSQLTemplate("SELECT ${id}, ${v}, ${x}", params)
+	require.ErrorIs(t, err, ErrUnknownPlaceholder)
+
+	_, err = newSQLTemplate("SELECT ${id}, '${v}'", params)
+	require.ErrorIs(t, err, ErrUnusedParam)
+
+	_, err = newSQLTemplate("SELECT ${id}, ${v", params)
+	require.ErrorIs(t, err, ErrUnterminatedPlaceholder)
+}
+
+func TestSQLTemplate_RenderOffset(t *testing.T) {
+	tmpl, err := newSQLTemplate("(${id}, ${v})", []*stroppy.QueryParamDescriptor{{Name: "id"}, {Name: "v"}})
+	require.NoError(t, err)
+	require.Equal(t, "($3, $4)", tmpl.render(2))
+}
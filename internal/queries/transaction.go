@@ -17,21 +17,53 @@ func NewTransaction(
 	descriptor *stroppy.TransactionDescriptor,
 	channel errchan.Chan[stroppy.DriverTransaction],
 ) {
-	defer errchan.Close[stroppy.DriverTransaction](channel)
-	lg.Debug("build transaction",
-		zap.String("name", descriptor.GetName()))
-
-	var queries []*stroppy.DriverQuery
+	plans := make([]*queryPlan, 0, len(descriptor.GetQueries()))
 
 	for _, query := range descriptor.GetQueries() {
-		q, err := NewQuerySync(ctx, lg, generators, buildContext, query)
+		plan, err := newQueryPlan(generators, buildContext, query)
 		if err != nil {
 			errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+			errchan.Close[stroppy.DriverTransaction](channel)
 
 			return
 		}
 
-		queries = append(queries, q.GetQueries()...)
+		plans = append(plans, plan)
+	}
+
+	newPlannedTransaction(ctx, lg, descriptor, plans, channel)
+}
+
+func newPlannedTransaction(
+	ctx context.Context,
+	lg *zap.Logger,
+	descriptor *stroppy.TransactionDescriptor,
+	plans []*queryPlan,
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	defer errchan.Close[stroppy.DriverTransaction](channel)
+	lg.Debug("build transaction",
+		zap.String("name", descriptor.GetName()))
+
+	var queries []*stroppy.DriverQuery
+
+	for _, plan := range plans {
+		for i := uint64(0); i < plan.descriptor.GetCount(); i++ { //nolint: intrange // allow
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			q, err := plan.newQuery()
+			if err != nil {
+				errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+
+				return
+			}
+
+			queries = append(queries, q)
+		}
 	}
 
 	errchan.Send[stroppy.DriverTransaction](channel, &stroppy.DriverTransaction{
@@ -0,0 +1,174 @@
+package queries
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+	"github.com/stroppy-io/stroppy-core/pkg/utils/errchan"
+)
+
+// maxBindParams is the PostgreSQL limit of bind parameters in a single statement.
+const maxBindParams = 65535
+
+var valuesInsertPrefixRe = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+[\w."]+\s*(?:\([^)]*\))?\s*VALUES\s*`)
+
+// valuesInsert is "INSERT INTO t (...) VALUES (<tuple>) <tail>" split around the tuple,
+// so the tuple can be repeated for several generated rows.
+type valuesInsert struct {
+	prefix string
+	tuple  *sqlTemplate
+	tail   string
+}
+
+// parseValuesInsert recognises inserts with a single VALUES tuple and placeholders only inside of it.
+func parseValuesInsert(descriptor *stroppy.QueryDescriptor) (*valuesInsert, bool) {
+	sql := descriptor.GetSql()
+
+	prefix := valuesInsertPrefixRe.FindString(sql)
+	if prefix == "" {
+		return nil, false
+	}
+
+	rest := sql[len(prefix):]
+	if !strings.HasPrefix(rest, "(") {
+		return nil, false
+	}
+
+	end := tupleEnd(rest)
+	if end < 0 {
+		return nil, false
+	}
+
+	tail := strings.TrimSuffix(strings.TrimSpace(rest[end+1:]), ";")
+	if _, err := newSQLTemplate(tail, nil); err != nil {
+		return nil, false
+	}
+
+	tuple, err := newSQLTemplate(rest[:end+1], descriptor.GetParams())
+	if err != nil {
+		return nil, false
+	}
+
+	return &valuesInsert{
+		prefix: prefix,
+		tuple:  tuple,
+		tail:   tail,
+	}, true
+}
+
+// tupleEnd returns index of the parenthesis closing the one at s[0].
+func tupleEnd(s string) int {
+	depth := 0
+
+	for pos := 0; pos < len(s); pos = skipToken(s, pos) {
+		switch s[pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pos
+			}
+		}
+	}
+
+	return -1
+}
+
+// render builds statement with rows tuples, placeholders of row k are numbered from k*paramsCount+1.
+func (v *valuesInsert) render(paramsCount, rows int) string {
+	var buf strings.Builder
+
+	buf.WriteString(v.prefix)
+
+	for row := range rows {
+		if row > 0 {
+			buf.WriteString(", ")
+		}
+
+		buf.WriteString(v.tuple.render(row * paramsCount))
+	}
+
+	if v.tail != "" {
+		buf.WriteString(" " + v.tail)
+	}
+
+	return buf.String()
+}
+
+// newPlannedValuesQuery folds every batchSize generated rows of the insert descriptor
+// into one multi-row "INSERT ... VALUES (...), (...)" statement,
+// so ceil(count/batchSize) transactions are produced instead of count. The plan must have values set.
+func newPlannedValuesQuery(
+	ctx context.Context,
+	lg *zap.Logger,
+	plan *queryPlan,
+	batchSize uint64,
+	channel errchan.Chan[stroppy.DriverTransaction],
+) {
+	defer errchan.Close[stroppy.DriverTransaction](channel)
+
+	batchSize = max(batchSize, 1)
+
+	descriptor, stmt := plan.descriptor, plan.values
+
+	if paramsCount := uint64(len(descriptor.GetParams())); batchSize*paramsCount > maxBindParams {
+		lg.Debug("multi-row insert batch size clamped to bind parameters limit",
+			zap.String("name", descriptor.GetName()),
+			zap.Uint64("batch_size", batchSize),
+			zap.Uint64("clamped_batch_size", maxBindParams/paramsCount),
+		)
+
+		batchSize = maxBindParams / paramsCount
+	}
+
+	lg.Debug("build multi-row insert query",
+		zap.String("name", descriptor.GetName()),
+		zap.String("query", descriptor.GetSql()),
+		zap.Uint64("batch_size", batchSize),
+	)
+
+	fullRequest := stmt.render(len(descriptor.GetParams()), int(batchSize)) //nolint: gosec // bounded by maxBindParams
+	params := make([]*stroppy.Value, 0, batchSize*uint64(len(descriptor.GetParams())))
+	rows := uint64(0)
+
+	for i := uint64(0); i < descriptor.GetCount(); i++ { //nolint: intrange // allow
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		paramsValues, err := plan.params()
+		if err != nil {
+			errchan.Send[stroppy.DriverTransaction](channel, nil, err)
+
+			return
+		}
+
+		params = append(params, paramsValues...)
+		rows++
+
+		if rows == batchSize || i == descriptor.GetCount()-1 {
+			request := fullRequest
+			if rows != batchSize {
+				request = stmt.render(len(descriptor.GetParams()), int(rows)) //nolint: gosec // rows < batchSize
+			}
+
+			errchan.Send[stroppy.DriverTransaction](channel, &stroppy.DriverTransaction{
+				Queries: []*stroppy.DriverQuery{{
+					Name:    descriptor.GetName(),
+					Request: request,
+					Params:  params,
+				}},
+			}, nil)
+
+			params = make([]*stroppy.Value, 0, cap(params))
+			rows = 0
+		}
+	}
+}
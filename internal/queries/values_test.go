@@ -0,0 +1,59 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	stroppy "github.com/stroppy-io/stroppy-core/pkg/proto"
+)
+
+func TestParseValuesInsert(t *testing.T) {
+	params := []*stroppy.QueryParamDescriptor{{Name: "id"}, {Name: "v"}}
+
+	stmt, ok := parseValuesInsert(&stroppy.QueryDescriptor{
+		Sql:    "INSERT INTO t (id, v) VALUES (${id}, coalesce(${v}, 'a)b')) ON CONFLICT DO NOTHING;",
+		Params: params,
+	})
+	require.True(t, ok)
+	require.Equal(t, "ON CONFLICT DO NOTHING", stmt.tail)
+	require.Equal(t,
+		"INSERT INTO t (id, v) VALUES ($1, coalesce($2, 'a)b')), ($3, coalesce($4, 'a)b')) ON CONFLICT DO NOTHING",
+		stmt.render(len(params), 2),
+	)
+
+	for _, sql := range []string{
+		"INSERT INTO t (id, v) SELECT ${id}, ${v}",
+		"INSERT INTO t (id, v) VALUES (${id}, 1) ON CONFLICT (id) DO UPDATE SET v = ${v}",
+		"UPDATE t SET v = ${v} WHERE id = ${id}",
+	} {
+		_, ok = parseValuesInsert(&stroppy.QueryDescriptor{Sql: sql, Params: params})
+		require.False(t, ok, sql)
+	}
+}
+
+func TestQueryBuilder_Build_Values(t *testing.T) {
+	transactions := buildInsert(t, InsertModeValues, 2, &stroppy.QueryDescriptor{
+		Name:   "load",
+		Sql:    "INSERT INTO t (id, v) VALUES (${id}, ${v} + 1)",
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("id", 1), constInt32Param("v", 2)},
+		Count:  5,
+	})
+	require.Len(t, transactions, 3)
+	require.Equal(t, "INSERT INTO t (id, v) VALUES ($1, $2 + 1), ($3, $4 + 1)", transactions[0].Queries[0].Request)
+	require.Len(t, transactions[0].Queries[0].Params, 4)
+	require.Equal(t, "INSERT INTO t (id, v) VALUES ($1, $2 + 1)", transactions[2].Queries[0].Request)
+	require.Len(t, transactions[2].Queries[0].Params, 2)
+}
+
+func TestQueryBuilder_Build_ValuesClampsBatchSize(t *testing.T) {
+	transactions := buildInsert(t, InsertModeValues, 40000, &stroppy.QueryDescriptor{
+		Name:   "load",
+		Sql:    "INSERT INTO t (id, v) VALUES (${id}, ${v})",
+		Params: []*stroppy.QueryParamDescriptor{constInt32Param("id", 1), constInt32Param("v", 2)},
+		Count:  maxBindParams/2 + 1,
+	})
+	require.Len(t, transactions, 2)
+	require.Len(t, transactions[0].Queries[0].Params, maxBindParams-1, "32767 rows of 2 params")
+	require.Len(t, transactions[1].Queries[0].Params, 2)
+}
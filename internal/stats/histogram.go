@@ -0,0 +1,154 @@
+// Package stats contains lock-free latency histograms recorded by the driver.
+package stats
+
+import (
+	"encoding/json"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// subBucketBits gives 2^subBucketBits sub-buckets per power of two,
+	// so recorded values keep ~1% precision, like HdrHistogram with 2 significant digits.
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+	// maxShift bounds trackable values by 2^(maxShift+subBucketBits) microseconds, that is ~1.6 days.
+	maxShift    = 30
+	bucketCount = maxShift*subBucketHalf + subBucketCount
+)
+
+// Histogram is a log-linear histogram of durations with microsecond resolution.
+// It is safe for concurrent use, Record does not allocate nor lock.
+type Histogram struct {
+	counts [bucketCount]atomic.Uint64
+	total  atomic.Uint64
+	sum    atomic.Uint64
+	max    atomic.Uint64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func bucketIndex(value uint64) int {
+	shift := max(bits.Len64(value)-subBucketBits, 0)
+	if shift > maxShift {
+		return bucketCount - 1
+	}
+
+	return shift*subBucketHalf + int(value>>shift) //nolint: gosec // value>>shift < subBucketCount
+}
+
+// bucketHighest returns the highest value which falls into bucket with the given index.
+func bucketHighest(idx int) uint64 {
+	if idx < subBucketCount {
+		return uint64(idx) //nolint: gosec // idx is not negative
+	}
+
+	shift := (idx - subBucketHalf) / subBucketHalf
+	sub := idx - shift*subBucketHalf
+
+	return uint64(sub+1)<<shift - 1 //nolint: gosec // sub is not negative
+}
+
+// Record adds the duration to the histogram, negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	value := uint64(max(d.Microseconds(), 0))
+
+	h.counts[bucketIndex(value)].Add(1)
+	h.total.Add(1)
+	h.sum.Add(value)
+
+	for {
+		current := h.max.Load()
+		if value <= current || h.max.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.total.Load()
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max.Load()) * time.Microsecond //nolint: gosec // bounded by recorded durations
+}
+
+// Quantile returns the value below which the q fraction of recorded durations fall,
+// within the histogram precision. q is clamped to [0, 1].
+func (h *Histogram) Quantile(q float64) time.Duration {
+	total := h.total.Load()
+	if total == 0 {
+		return 0
+	}
+
+	q = min(max(q, 0), 1)
+	rank := max(uint64(q*float64(total)+0.5), 1) //nolint: mnd // round half up
+
+	seen := uint64(0)
+
+	for idx := range h.counts {
+		seen += h.counts[idx].Load()
+		if seen >= rank {
+			return min(
+				time.Duration(bucketHighest(idx))*time.Microsecond, //nolint: gosec // bounded by bucketCount
+				h.Max(),
+			)
+		}
+	}
+
+	return h.Max()
+}
+
+// Summary is a point in time view of the histogram.
+// It is marshaled to JSON with durations in microseconds.
+type Summary struct {
+	Count uint64
+	Sum   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+//nolint:mnd // percentiles
+func (h *Histogram) Summary() Summary {
+	summary := Summary{
+		Count: h.Count(),
+		Sum:   time.Duration(h.sum.Load()) * time.Microsecond, //nolint: gosec // bounded by recorded durations
+		P50:   h.Quantile(0.50),
+		P95:   h.Quantile(0.95),
+		P99:   h.Quantile(0.99),
+		Max:   h.Max(),
+	}
+
+	if summary.Count > 0 {
+		summary.Mean = time.Duration(h.sum.Load()/summary.Count) * time.Microsecond //nolint: gosec // mean <= max
+	}
+
+	return summary
+}
+
+func (s Summary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count uint64 `json:"count"`
+		Sum   int64  `json:"sum_us"`
+		Mean  int64  `json:"mean_us"`
+		P50   int64  `json:"p50_us"`
+		P95   int64  `json:"p95_us"`
+		P99   int64  `json:"p99_us"`
+		Max   int64  `json:"max_us"`
+	}{
+		Count: s.Count,
+		Sum:   s.Sum.Microseconds(),
+		Mean:  s.Mean.Microseconds(),
+		P50:   s.P50.Microseconds(),
+		P95:   s.P95.Microseconds(),
+		P99:   s.P99.Microseconds(),
+		Max:   s.Max.Microseconds(),
+	})
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketIndex(t *testing.T) {
+	for _, value := range []uint64{0, 1, 63, 64, 127, 128, 129, 1000, 123456, 1 << 36} {
+		idx := bucketIndex(value)
+		require.GreaterOrEqual(t, bucketHighest(idx), value, value)
+
+		if idx > 0 {
+			require.Less(t, bucketHighest(idx-1), value, value)
+		}
+	}
+
+	require.Equal(t, bucketCount-1, bucketIndex(1<<62))
+}
+
+func TestHistogram_Summary(t *testing.T) {
+	hist := NewHistogram()
+	require.Equal(t, Summary{}, hist.Summary())
+
+	for i := 1; i <= 1000; i++ {
+		hist.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	summary := hist.Summary()
+	require.Equal(t, uint64(1000), summary.Count)
+	require.InEpsilon(t, 500*time.Millisecond, summary.P50, 0.01)
+	require.InEpsilon(t, 950*time.Millisecond, summary.P95, 0.01)
+	require.InEpsilon(t, 990*time.Millisecond, summary.P99, 0.01)
+	require.Equal(t, time.Second, summary.Max)
+	require.InEpsilon(t, 500500*time.Microsecond, summary.Mean, 0.001)
+	require.Equal(t, 500500*time.Millisecond, summary.Sum)
+
+	data, err := json.Marshal(Summary{Count: 1, P50: time.Millisecond, Max: 2 * time.Millisecond})
+	require.NoError(t, err)
+	require.JSONEq(t,
+		`{"count":1,"sum_us":0,"mean_us":0,"p50_us":1000,"p95_us":0,"p99_us":0,"max_us":2000}`,
+		string(data),
+	)
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	require.Same(t, registry.Histogram("a"), registry.Histogram("a"))
+
+	registry.Histogram("a").Record(time.Millisecond)
+	registry.Histogram("b")
+
+	summaries := registry.Summaries()
+	require.Len(t, summaries, 2)
+	require.Equal(t, uint64(1), summaries["a"].Count)
+	require.Zero(t, summaries["b"].Count)
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	cmap "github.com/orcaman/concurrent-map/v2"
+)
+
+// Registry holds histograms by name, they are created on first use.
+type Registry struct {
+	histograms cmap.ConcurrentMap[string, *Histogram]
+}
+
+func NewRegistry() *Registry {
+	return &Registry{histograms: cmap.New[*Histogram]()}
+}
+
+func (r *Registry) Histogram(name string) *Histogram {
+	if hist, ok := r.histograms.Get(name); ok {
+		return hist
+	}
+
+	r.histograms.SetIfAbsent(name, NewHistogram())
+	hist, _ := r.histograms.Get(name)
+
+	return hist
+}
+
+// Summaries returns summary of every histogram by name.
+func (r *Registry) Summaries() map[string]Summary {
+	summaries := make(map[string]Summary, r.histograms.Count())
+	for name, hist := range r.Histograms() {
+		summaries[name] = hist.Summary()
+	}
+
+	return summaries
+}
+
+// Histograms returns a snapshot of histograms by name.
+func (r *Registry) Histograms() map[string]*Histogram {
+	return r.histograms.Items()
+}